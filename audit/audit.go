@@ -0,0 +1,174 @@
+// Package audit records who changed what in the directory, and when
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/liut/staffio-backend/model"
+)
+
+// actions of directory mutations
+const (
+	ActionSave           = "save"
+	ActionModifyBySelf   = "modify_by_self"
+	ActionModify         = "modify"
+	ActionPatch          = "patch"
+	ActionDelete         = "delete"
+	ActionRename         = "rename"
+	ActionPasswordReset  = "password_reset"
+	ActionPasswordChange = "password_change"
+	ActionSaveGroup      = "save_group"
+	ActionEraseGroup     = "erase_group"
+	ActionSetPhoto       = "set_photo"
+	ActionDeletePhoto    = "delete_photo"
+)
+
+// Outcome ...
+type Outcome string
+
+// outcomes of an action
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+)
+
+// nolint
+var (
+	// SecretFields names of fields which values are always redacted, in lower case
+	SecretFields = map[string]bool{
+		"password":     true,
+		"passwd":       true,
+		"userpassword": true,
+		"unicodepwd":   true,
+	}
+)
+
+// Event a mutation of the directory
+type Event struct {
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor,omitempty"` // who did it, empty if unknown
+	Action  string    `json:"action"`
+	Target  string    `json:"target"` // uid of people or name of group
+	Changes []Change  `json:"changes,omitempty"`
+	Outcome Outcome   `json:"outcome"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Change of a field, Old or New is nil if absent
+type Change struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old,omitempty"`
+	New   interface{} `json:"new,omitempty"`
+}
+
+// Sink receives events, it must be safe for concurrent use
+type Sink interface {
+	Write(ev *Event) error
+}
+
+// NewEvent returns an event of action on target at now, the outcome is a failure if err is not nil
+func NewEvent(actor, action, target string, changes []Change, err error) *Event {
+	ev := &Event{
+		Time:    time.Now(),
+		Actor:   actor,
+		Action:  action,
+		Target:  target,
+		Changes: changes,
+		Outcome: OutcomeSuccess,
+	}
+	if err != nil {
+		ev.Outcome = OutcomeFailure
+		ev.Error = err.Error()
+	}
+	return ev
+}
+
+// IsSecret reports whether the value of field should be redacted, a password
+// or a People field not public by model.GetLogPolicy, even if it is Unredacted
+func IsSecret(field string) bool {
+	if SecretFields[strings.ToLower(field)] {
+		return true
+	}
+	return model.GetLogPolicy().Fields[field] != model.SensitivityPublic
+}
+
+// Diff returns changed fields between before and after by their JSON names, sorted by name,
+// either may be nil, values of secret fields and of more ones in secrets, such as sealed fields,
+// are replaced with model.Redacted
+func Diff(before, after interface{}, secrets ...string) []Change {
+	old, cur := fields(before), fields(after)
+	var changes []Change
+	for k, v := range cur {
+		if ov, ok := old[k]; !ok || !reflect.DeepEqual(ov, v) {
+			changes = append(changes, Change{Field: k, Old: ov, New: v})
+		}
+	}
+	for k, ov := range old {
+		if _, ok := cur[k]; !ok {
+			changes = append(changes, Change{Field: k, Old: ov})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	for i := range changes {
+		if IsSecret(changes[i].Field) || contains(secrets, changes[i].Field) {
+			changes[i] = changes[i].redact()
+		}
+	}
+	return changes
+}
+
+func (c Change) redact() Change {
+	if c.Old != nil {
+		c.Old = model.Redacted
+	}
+	if c.New != nil {
+		c.New = model.Redacted
+	}
+	return c
+}
+
+func contains(names []string, name string) bool {
+	for _, s := range names {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fields returns non-empty fields of v by its JSON encoding
+func fields(v interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return m
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+	_ = json.Unmarshal(b, &m)
+	for k, v := range m {
+		if isEmpty(v) {
+			delete(m, k)
+		}
+	}
+	return m
+}
+
+func isEmpty(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return true
+	case string:
+		return x == ""
+	case []interface{}:
+		return len(x) == 0
+	case map[string]interface{}:
+		return len(x) == 0
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileSink appends events to a file as JSON lines
+type FileSink struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewFileSink opens or creates the file of name for appending
+func NewFileSink(name string) (*FileSink, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Write ...
+func (s *FileSink) Write(ev *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(ev)
+}
+
+// Close ...
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// MemorySink keeps events in memory, for tests
+type MemorySink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+// Write ...
+func (s *MemorySink) Write(ev *Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, *ev)
+	return nil
+}
+
+// Events returns a copy of written events
+func (s *MemorySink) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+// Reset drops written events
+func (s *MemorySink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = nil
+}
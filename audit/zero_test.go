@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio-backend/model"
+)
+
+type item struct {
+	Name     string   `json:"name"`
+	Mail     string   `json:"mail,omitempty"`
+	Password string   `json:"password,omitempty"`
+	Members  []string `json:"members"`
+}
+
+func TestDiff(t *testing.T) {
+	before := &item{Name: "doe", Mail: "doe@example.org", Password: "old", Members: []string{"a"}}
+	after := &item{Name: "doe", Password: "new", Members: []string{"a", "b"}}
+
+	changes := Diff(before, after)
+	assert.Equal(t, []Change{
+		{Field: "mail", Old: "doe@example.org"},
+		{Field: "members", Old: []interface{}{"a"}, New: []interface{}{"a", "b"}},
+		{Field: "password", Old: model.Redacted, New: model.Redacted},
+	}, changes)
+
+	changes = Diff(nil, &item{Name: "doe"})
+	assert.Equal(t, []Change{{Field: "name", New: "doe"}}, changes)
+	var none *item
+	changes = Diff(&item{Name: "doe"}, none)
+	assert.Equal(t, []Change{{Field: "name", Old: "doe"}}, changes)
+	assert.Empty(t, Diff(before, before))
+	assert.True(t, IsSecret("userPassword"))
+
+	// personal data by the log policy, and more secrets
+	u1 := &model.People{UID: "doe", Email: "doe@example.org", Mobile: "13012341234", IDCN: "110101199003077777"}
+	u2 := &model.People{UID: "doe", Email: "fawn@example.org", Nickname: "fawn", JoinDate: "20200102"}
+	changes = Diff(u1, u2, "joinDate")
+	assert.Equal(t, []Change{
+		{Field: "email", Old: model.Redacted, New: model.Redacted},
+		{Field: "idcn", Old: model.Redacted},
+		{Field: "joinDate", New: model.Redacted},
+		{Field: "mobile", Old: model.Redacted},
+		{Field: "nickname", New: "fawn"},
+	}, changes)
+	assert.True(t, IsSecret("birthday"))
+	assert.False(t, IsSecret("nickname"))
+}
+
+func TestNewEvent(t *testing.T) {
+	ev := NewEvent("admin", ActionDelete, "doe", nil, nil)
+	assert.Equal(t, OutcomeSuccess, ev.Outcome)
+	assert.False(t, ev.Time.IsZero())
+
+	ev = NewEvent("admin", ActionDelete, "doe", nil, errors.New("denied"))
+	assert.Equal(t, OutcomeFailure, ev.Outcome)
+	assert.Equal(t, "denied", ev.Error)
+}
+
+func TestFileSink(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileSink(name)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, sink.Write(NewEvent("admin", ActionSave, "doe", []Change{{Field: "mail", New: "doe@example.org"}}, nil)))
+	assert.NoError(t, sink.Write(NewEvent("doe", ActionPasswordChange, "doe", nil, errors.New("denied"))))
+	assert.NoError(t, sink.Close())
+
+	f, err := os.Open(name)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev Event
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+		events = append(events, ev)
+	}
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, ActionSave, events[0].Action)
+		assert.Equal(t, "mail", events[0].Changes[0].Field)
+		assert.Equal(t, OutcomeFailure, events[1].Outcome)
+	}
+}
+
+func TestMemorySink(t *testing.T) {
+	var sink MemorySink
+	assert.NoError(t, sink.Write(NewEvent("", ActionRename, "doe", nil, nil)))
+	assert.Len(t, sink.Events(), 1)
+	sink.Reset()
+	assert.Empty(t, sink.Events())
+}
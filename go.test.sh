@@ -4,10 +4,26 @@ set -e
 
 true > coverage.txt
 
-for d in $(go list ./... | grep -v vendor); do
-    go test -race -coverprofile=profile.out -covermode=atomic "$d"
-    if [ -f profile.out ]; then
-        cat profile.out >> coverage.txt
-        rm profile.out
-    fi
+# nested modules require a tagged version of the root, test them against this tree in a workspace
+if [ ! -f go.work ]; then
+    trap 'rm -f go.work go.work.sum' EXIT
+    GOFLAGS=$(echo "$GOFLAGS" | sed 's/-mod=[a-z]*//')
+    export GOFLAGS
+    go work init .
+    for m in $(find . -mindepth 2 -name go.mod -not -path "./vendor/*" -exec dirname {} \;); do
+        go work use "$m"
+        v=$(sed -n 's#^[[:space:]]*github.com/liut/staffio-backend \(v[^ ]*\).*#\1#p' "$m/go.mod")
+        [ -n "$v" ] && go work edit -replace="github.com/liut/staffio-backend@$v=./"
+    done
+fi
+
+# nested modules, such as ldap/oteltrace, are tested in their own directory
+for m in $(find . -name go.mod -not -path "./vendor/*" -exec dirname {} \;); do
+    for d in $(cd "$m" && go list ./...); do
+        (cd "$m" && go test -race -coverprofile=profile.out -covermode=atomic "$d")
+        if [ -f "$m/profile.out" ]; then
+            cat "$m/profile.out" >> coverage.txt
+            rm "$m/profile.out"
+        fi
+    done
 done
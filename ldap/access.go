@@ -0,0 +1,116 @@
+package ldap
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Role of the one who modifies a People
+type Role string
+
+// roles
+const (
+	RoleSelf    Role = "self"
+	RoleManager Role = "manager"
+	RoleHR      Role = "hr"
+	RoleAdmin   Role = "admin"
+)
+
+// AllFields allows a role to change any field
+const AllFields = "*"
+
+// FieldPolicy fields of People by JSON names which each role may change, a role not listed may change nothing
+type FieldPolicy map[Role][]string
+
+// DefaultFieldPolicy personal fields for self, the organization for HR, all for admin
+var DefaultFieldPolicy = FieldPolicy{
+	RoleSelf:    {"nickname", "avatarPath", "mobile", "tel", "birthday", "gender"},
+	RoleManager: {"nickname", "avatarPath", "description", "etype", "dept"},
+	RoleHR: {"cn", "gn", "sn", "nickname", "avatarPath", "mobile", "tel", "birthday", "gender", "email",
+		"eid", "etype", "description", "joinDate", "idcn", "org", "dept"},
+	RoleAdmin: {AllFields},
+}
+
+// fieldOfAttr JSON names of People by attribute names in lower case
+var fieldOfAttr = map[string]string{
+	"cn":              "cn",
+	"givenname":       "gn",
+	"sn":              "sn",
+	"displayname":     "nickname",
+	"mail":            "email",
+	"mobile":          "mobile",
+	"telephonenumber": "tel",
+	"avatarpath":      "avatarPath",
+	"gender":          "gender",
+	"dateofbirth":     "birthday",
+	"dateofjoin":      "joinDate",
+	"description":     "description",
+	"employeenumber":  "eid",
+	"employeetype":    "etype",
+	"idcnnumber":      "idcn",
+	"o":               "org",
+	"ou":              "dept",
+	"jpegphoto":       "jpegPhoto",
+}
+
+// FieldAccessError fields of People which the role may not change
+type FieldAccessError struct {
+	Role   Role
+	Fields []string
+}
+
+func (e *FieldAccessError) Error() string {
+	return "fields not allowed to change by " + string(e.Role) + ": " + strings.Join(e.Fields, ", ")
+}
+
+// Unwrap returns ErrAccessDenied
+func (e *FieldAccessError) Unwrap() error {
+	return ErrAccessDenied
+}
+
+// Allowed reports whether role may change field
+func (p FieldPolicy) Allowed(role Role, field string) bool {
+	for _, f := range p[role] {
+		if f == AllFields || f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns a *FieldAccessError with the fields which role may not change, nil if all allowed
+func (p FieldPolicy) Check(role Role, fields ...string) error {
+	var rejected []string
+	for _, f := range fields {
+		if !p.Allowed(role, f) {
+			rejected = append(rejected, f)
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	sort.Strings(rejected)
+	return &FieldAccessError{Role: role, Fields: rejected}
+}
+
+// changedFields returns JSON names of People changed by mr, other than bookkeeping attributes
+func changedFields(mr *ldap.ModifyRequest) (fields []string) {
+	seen := make(map[string]bool)
+	for _, c := range mr.Changes {
+		name := strings.ToLower(c.Modification.Type)
+		if name == "modifiedtime" {
+			continue
+		}
+		field, ok := fieldOfAttr[name]
+		if !ok {
+			field = c.Modification.Type
+		}
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	return
+}
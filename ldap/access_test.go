@@ -0,0 +1,125 @@
+package ldap
+
+import (
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio-backend/audit"
+	"github.com/liut/staffio-backend/model"
+)
+
+func TestFieldPolicy(t *testing.T) {
+	p := DefaultFieldPolicy
+	assert.NoError(t, p.Check(RoleSelf, "nickname", "mobile"))
+	assert.NoError(t, p.Check(RoleAdmin, "etype", "anything"))
+	err := p.Check(RoleSelf, "nickname", "etype", "description")
+	assert.EqualError(t, err, "fields not allowed to change by self: description, etype")
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	assert.Error(t, p.Check(Role("guest"), "nickname"))
+
+	mr := ldap.NewModifyRequest("uid=doe", nil)
+	mr.Replace("displayName", []string{"Doe"})
+	mr.Replace("employeeType", []string{"CEO"})
+	mr.Replace("modifiedTime", []string{"20240101000000Z"})
+	mr.Add("objectClass", []string{"staffioPerson"})
+	assert.Equal(t, []string{"nickname", "etype", "objectClass"}, changedFields(mr))
+}
+
+func TestModifyBySelf(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	sink := new(audit.MemorySink)
+	s := &Store{sources: []*ldapSource{dir.newSource()}, audit: sink}
+	defer s.Close()
+
+	staff, err := s.Get("doe")
+	if !assert.NoError(t, err) {
+		return
+	}
+	staff.Version = "" // unchecked, see TestOptimisticPeople
+	staff.Nickname = "Doe"
+	staff.EmployeeType = "CEO"
+	staff.Description = "boss"
+	err = s.ModifyBySelf("doe", "secret", staff)
+	var fae *FieldAccessError
+	if assert.ErrorAs(t, err, &fae) {
+		assert.Equal(t, RoleSelf, fae.Role)
+		assert.Equal(t, []string{"description", "etype"}, fae.Fields)
+	}
+	assert.ErrorIs(t, err, ErrAccessDenied)
+	assert.Empty(t, dir.callsOf("modify"), "rejected before sent")
+	assert.Empty(t, dir.attr(dn, "displayName"))
+
+	staff.EmployeeType, staff.Description = "", ""
+	staff.Email = "doe"
+	assert.ErrorIs(t, s.ModifyBySelf("doe", "secret", staff), model.ErrInvalidPeople)
+	assert.Empty(t, dir.callsOf("modify"), "rejected before sent")
+	staff.Email = ""
+	assert.NoError(t, s.ModifyBySelf("doe", "secret", staff))
+	assert.Equal(t, "Doe", dir.attr(dn, "displayName"))
+	if calls := dir.callsOf("modify"); assert.Len(t, calls, 1) {
+		assert.Equal(t, dn, calls[0].by, "bound as self")
+	}
+	assert.Len(t, dir.get(dn)["objectclass"], len(objectClassPeople), "not replaced")
+
+	staff.EmployeeType = "CEO"
+	assert.NoError(t, s.ModifyAs(RoleManager, "doe", staff))
+	assert.Equal(t, "CEO", dir.attr(dn, "employeeType"))
+	if calls := dir.callsOf("modify"); assert.Len(t, calls, 2) {
+		assert.Equal(t, fakeAdminDN, calls[1].by)
+	}
+	staff.Gender = "Male"
+	assert.ErrorIs(t, s.ModifyAs(RoleManager, "doe", staff), model.ErrInvalidPeople)
+	staff.Gender = ""
+	staff.EmployeeNumber = "007"
+	assert.Error(t, s.ModifyAs(RoleManager, "doe", staff))
+	s.sources[0].fields = FieldPolicy{RoleManager: {"eid"}}
+	assert.NoError(t, s.ModifyAs(RoleManager, "doe", staff))
+
+	events := sink.Events()
+	if assert.Len(t, events, 7) {
+		assert.Equal(t, audit.OutcomeFailure, events[0].Outcome)
+		assert.Equal(t, audit.OutcomeFailure, events[1].Outcome)
+		assert.Equal(t, audit.ActionModify, events[3].Action)
+	}
+
+	// sealed values are compared as opened, not as changed
+	ls := s.sources[0]
+	ls.sealer = newFakeSealer(t, "k1")
+	ls.sealed = []string{"idcnNumber", "mobile", "dateOfBirth"}
+	ls.fields = nil
+	staff, err = s.Get("doe")
+	if !assert.NoError(t, err) {
+		return
+	}
+	staff.IDCN, staff.Mobile, staff.Birthday = "110101199001011237", "13012341234", "1990-01-01"
+	assert.NoError(t, s.ModifyAs(RoleAdmin, "doe", staff))
+	assert.Empty(t, dir.attr(dn, "idcnNumber"))
+	staff, err = s.Get("doe")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "110101199001011237", staff.IDCN)
+		staff.Version = ""
+		staff.Nickname = "John"
+		assert.NoError(t, s.ModifyBySelf("doe", "secret", staff))
+		assert.Equal(t, "John", dir.attr(dn, "displayName"))
+	}
+	staff.IDCN = "110101199001011245"
+	err = s.ModifyBySelf("doe", "secret", staff)
+	if assert.ErrorAs(t, err, &fae) {
+		assert.Equal(t, []string{"idcn"}, fae.Fields)
+	}
+}
+
+func TestMissingClasses(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	dir.entries[dn]["objectclass"] = []string{"top", "inetOrgPerson"}
+	ls := dir.newSource()
+	defer ls.Close()
+
+	_, err := ls.savePeople(&People{UID: "doe", Surname: "doe", CommonName: "doe"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, objectClassPeople, dir.get(dn)["objectclass"])
+}
@@ -0,0 +1,80 @@
+package ldap
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/liut/staffio-backend/audit"
+	"github.com/liut/staffio-backend/model"
+)
+
+// WithActor returns a shallow copy of Store, its mutations are audited as done by actor
+func (s *Store) WithActor(actor string) *Store {
+	s2 := *s
+	s2.actor = actor
+	return &s2
+}
+
+// auditGet returns people of uid before a mutation, nil if not audited or not found
+func (s *Store) auditGet(uid string) *People {
+	if s.audit == nil {
+		return nil
+	}
+	staff, err := s.Get(uid)
+	if err != nil {
+		return nil
+	}
+	return staff
+}
+
+// emitPeople emits the changes of people, after is read back from the directory if ok
+func (s *Store) emitPeople(action, uid string, before, after *People, err error) {
+	if s.audit == nil {
+		return
+	}
+	if err == nil && after != nil {
+		if staff, e := s.Get(uid); e == nil {
+			after = staff
+		}
+	}
+	s.emit(action, uid, audit.Diff(before, after, s.sealedFields()...), err)
+}
+
+// sealedFields JSON names of sealed fields of People, redacted in events like personal data
+func (s *Store) sealedFields() (fields []string) {
+	for _, ls := range s.sources {
+		if ls.sealer == nil || ls.isAD {
+			continue
+		}
+		for _, name := range ls.sealed {
+			if f, ok := fieldOfAttr[strings.ToLower(name)]; ok {
+				fields = append(fields, f)
+			}
+		}
+	}
+	return
+}
+
+// auditSink returns sink, nil if it is a nil pointer in the interface, so that mutations are not audited
+func auditSink(sink audit.Sink) audit.Sink {
+	if sink == nil {
+		return nil
+	}
+	if v := reflect.ValueOf(sink); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+	return sink
+}
+
+func (s *Store) emit(action, target string, changes []audit.Change, err error) {
+	if s.audit == nil {
+		return
+	}
+	if e := s.audit.Write(audit.NewEvent(s.actor, action, target, changes, err)); e != nil {
+		logger().Infow("audit fail", "action", action, "target", target, "err", e)
+	}
+}
+
+func passwordChanges() []audit.Change {
+	return []audit.Change{{Field: "password", New: model.Redacted}}
+}
@@ -0,0 +1,104 @@
+package ldap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio-backend/audit"
+	"github.com/liut/staffio-backend/model"
+)
+
+func TestAudit(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.addPeople("doe", "secret")
+	sink := new(audit.MemorySink)
+	store := &Store{sources: []*ldapSource{dir.newSource()}, audit: sink}
+	defer store.Close()
+	s := store.WithActor("admin")
+
+	_, err := s.Save(&People{UID: "roe", CommonName: "Roe", Surname: "Roe", GivenName: "R", Email: "roe@example.org"})
+	assert.NoError(t, err)
+	_, err = s.Save(&People{UID: "roe", CommonName: "Roe", Surname: "Roe", GivenName: "R", Email: "roe2@example.org"})
+	assert.NoError(t, err)
+	assert.NoError(t, s.PasswordReset("roe", "secret2"))
+	assert.Error(t, store.WithActor("roe").PasswordChange("roe", "bad", "secret3"))
+	assert.NoError(t, s.Delete("roe"))
+	assert.Error(t, store.Delete("nobody"))
+
+	events := sink.Events()
+	if !assert.Len(t, events, 6) {
+		return
+	}
+	ev := events[0]
+	assert.Equal(t, audit.ActionSave, ev.Action)
+	assert.Equal(t, "admin", ev.Actor)
+	assert.Equal(t, "roe", ev.Target)
+	assert.Equal(t, audit.OutcomeSuccess, ev.Outcome)
+	assert.Contains(t, ev.Changes, audit.Change{Field: "email", New: model.Redacted})
+	assert.Contains(t, ev.Changes, audit.Change{Field: "sn", New: "Roe"})
+
+	assert.Contains(t, events[1].Changes, audit.Change{Field: "email", Old: model.Redacted, New: model.Redacted})
+
+	assert.Equal(t, audit.ActionPasswordReset, events[2].Action)
+	assert.Equal(t, []audit.Change{{Field: "password", New: model.Redacted}}, events[2].Changes)
+
+	assert.Equal(t, audit.ActionPasswordChange, events[3].Action)
+	assert.Equal(t, "roe", events[3].Actor)
+	assert.Equal(t, audit.OutcomeFailure, events[3].Outcome)
+	assert.NotEmpty(t, events[3].Error)
+
+	assert.Equal(t, audit.ActionDelete, events[4].Action)
+	assert.Contains(t, events[4].Changes, audit.Change{Field: "email", Old: model.Redacted})
+	for _, c := range events[4].Changes {
+		assert.Nil(t, c.New)
+	}
+
+	assert.Empty(t, events[5].Actor)
+	assert.Equal(t, audit.OutcomeFailure, events[5].Outcome)
+	assert.Equal(t, "admin", s.actor)
+	assert.Empty(t, store.actor)
+}
+
+func TestAuditSealed(t *testing.T) {
+	// all public in logs, sealed fields are still redacted
+	model.SetLogPolicy(&model.LogPolicy{})
+	defer model.SetLogPolicy(nil)
+
+	dir := newFakeDirectory()
+	ls := dir.newSource()
+	ls.sealer = newFakeSealer(t, "k1")
+	ls.sealed = []string{"mobile"}
+	sink := new(audit.MemorySink)
+	store := &Store{sources: []*ldapSource{ls}, audit: sink}
+	defer store.Close()
+
+	_, err := store.Save(&People{UID: "roe", Surname: "Roe", GivenName: "R", Email: "roe@example.org", Mobile: "13800138000"})
+	assert.NoError(t, err)
+	if events := sink.Events(); assert.Len(t, events, 1) {
+		assert.Contains(t, events[0].Changes, audit.Change{Field: "email", New: "roe@example.org"})
+		assert.Contains(t, events[0].Changes, audit.Change{Field: "mobile", New: model.Redacted})
+	}
+}
+
+func TestAuditNone(t *testing.T) {
+	var sink *audit.FileSink
+	assert.Nil(t, auditSink(sink))
+	assert.Nil(t, auditSink(nil))
+
+	dir := newFakeDirectory()
+	dir.addPeople("doe", "secret")
+	store := &Store{sources: []*ldapSource{dir.newSource()}, audit: auditSink(sink)}
+	defer store.Close()
+
+	// no reads of before and after without a sink, Get searches the base
+	assert.NoError(t, store.ModifyAs(RoleAdmin, "doe", &People{UID: "doe", CommonName: "doe", Surname: "doe", Nickname: "Doe"}))
+	assert.NoError(t, store.Delete("doe"))
+	for _, c := range dir.callsOf("search") {
+		assert.NotEqual(t, fakeBase, c.dn)
+	}
+	_, err := store.Get("nobody")
+	assert.ErrorIs(t, err, ErrNotFound)
+	calls := dir.callsOf("search")
+	assert.Equal(t, fakeBase, calls[len(calls)-1].dn)
+}
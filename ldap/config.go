@@ -4,12 +4,19 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"time"
 
 	"github.com/go-ldap/ldap/v3"
+
+	"github.com/liut/staffio-backend/audit"
+	"github.com/liut/staffio-backend/ldap/pool"
+	"github.com/liut/staffio-backend/model"
+	"github.com/liut/staffio-backend/passwd"
+	"github.com/liut/staffio-backend/seal"
 )
 
 var (
-	reUID = regexp.MustCompile("^[a-z][a-z0-9-_]+$")
+	reUID = regexp.MustCompile(model.UIDPattern)
 )
 
 /*
@@ -30,6 +37,48 @@ type Config struct {
 	Passwd   string `json:"-"`
 	Domain   string `json:"domain"`
 	PageSize int    `json:"-"`
+
+	// AuthPoolSize size of the pool for user binds, default DefaultAuthPoolSize
+	AuthPoolSize int `json:"authPoolSize,omitempty"`
+	// HealthCheckIdle reads root DSE before a connection idled for it is used,
+	// default DefaultHealthCheckIdle, negative to disable
+	HealthCheckIdle time.Duration `json:"healthCheckIdle,omitempty"`
+	// KeepAlive probes idle connections in background at the interval, zero to disable
+	KeepAlive time.Duration `json:"keepAlive,omitempty"`
+	// Breaker options of circuit breaker of each host, optional
+	Breaker *pool.BreakerOptions `json:"-"`
+	// Observer records operations of each host, such as *metrics.Registry, optional
+	Observer Observer `json:"-"`
+	// Tracer starts spans around operations, optional
+	Tracer Tracer `json:"-"`
+
+	// PasswordMode how to write password, empty to detect Password Modify extended operation of server
+	PasswordMode string `json:"passwordMode,omitempty"`
+	// PasswordScheme hash scheme of userPassword in PasswordModeHash, default passwd.DefaultScheme
+	PasswordScheme string `json:"passwordScheme,omitempty"`
+
+	// PasswordPolicy checks new password of PasswordChange and PasswordReset, optional
+	PasswordPolicy *passwd.Policy `json:"-"`
+	// Audit receives an event of each mutation, optional
+	Audit audit.Sink `json:"-"`
+	// Validator checks People of Save, default the zero model.Validator
+	Validator *model.Validator `json:"-"`
+	// PhotoMaxSize bytes of a photo accepted by SetPhoto, default photo.DefaultMaxSize
+	PhotoMaxSize int `json:"photoMaxSize,omitempty"`
+
+	// Sealer encrypts SealedAttributes of People at rest, optional, not for Active Directory
+	Sealer *seal.Sealer `json:"-"`
+	// SealedAttributes names of sealed attributes, default DefaultSealedAttributes,
+	// one of idcnNumber, mobile, dateOfBirth and dateOfJoin
+	SealedAttributes []string `json:"sealedAttributes,omitempty"`
+
+	// FieldPolicy fields each role may change by ModifyBySelf and ModifyAs, default DefaultFieldPolicy
+	FieldPolicy FieldPolicy `json:"-"`
+
+	// RecordLogins writes lastLoginTime and loginCount on each successful Authenticate,
+	// for a directory without the lastbind overlay, ignored on Active Directory.
+	// A login changes the version of People, so a write with an older Version is an ErrConflict
+	RecordLogins bool `json:"recordLogins,omitempty"`
 }
 
 var zeroConfig = &Config{}
@@ -63,6 +112,12 @@ func (c *Config) CopyFrom(o Config) {
 	if o.Passwd != "" && o.Passwd != c.Passwd {
 		c.Passwd = o.Passwd
 	}
+	if o.PasswordMode != "" && o.PasswordMode != c.PasswordMode {
+		c.PasswordMode = o.PasswordMode
+	}
+	if o.PasswordScheme != "" && o.PasswordScheme != c.PasswordScheme {
+		c.PasswordScheme = o.PasswordScheme
+	}
 }
 
 type entryType struct {
@@ -132,28 +187,40 @@ func makeDN(pk, name, parent string) string {
 	return fmt.Sprintf("%s=%s,%s", pk, name, parent)
 }
 
+// password modes
+const (
+	PasswordModeAuto     = ""         // detect by supportedExtension of root DSE
+	PasswordModeExtended = "extended" // Password Modify extended operation (RFC 3062)
+	PasswordModeHash     = "hash"     // hash in client and modify userPassword
+)
+
 // consts
 const (
 	TimeLayout = "20060102150405Z"
-	DateLayout = "20060102"
+	DateLayout = model.DateLayoutLDAP
+
+	DefaultPageSize     = 100
+	DefaultPoolSize     = 10
+	DefaultAuthPoolSize = 10
 
-	DefaultPageSize = 100
-	DefaultPoolSize = 10
+	DefaultHealthCheckIdle = time.Minute
 )
 
 var (
 	etBase   = newEentryType("dc", "", "dc", "o", "instanceType") // dcObject
 	etParent = newEentryType("ou", "organizationalUnit", "ou")
-	etGroup  = newEentryType("cn", "groupOfNames", "cn", "member")
+	etGroup  = newEentryType("cn", "groupOfNames", "cn", "member", "entryCSN", "modifyTimestamp")
 	etPeople = newEentryType("uid", "inetOrgPerson", "uid",
 		"cn", "gn", "sn", "displayName", "mail", "mobile", "description", "metaJSON",
 		"createdTime", "modifiedTime", "createTimestamp", "modifyTimestamp", "jpegPhoto",
-		"avatarPath", "dateOfBirth", "gender", "employeeNumber", "employeeType", "title")
+		"avatarPath", "dateOfBirth", "dateOfJoin", "gender", "employeeNumber", "employeeType", "title",
+		"idcnNumber", attrSealed, "objectClass", "entryCSN", "authTimestamp", attrLastLogin, attrLoginCount)
 
-	etADgroup = newEentryType("cn", "group", "cn", "member", "name", "description", "instanceType")
+	etADgroup = newEentryType("cn", "group", "cn", "member", "name", "description", "instanceType", "uSNChanged")
 	etADuser  = newEentryType("cn", "user", "cn", "name", "sAMAccountName", "userPrincipalName",
 		"uid", "gn", "sn", "displayName", "mail", "mobile", "description",
-		"employeeNumber", "employeeType", "title", "jpegPhoto", "logonCount")
+		"employeeNumber", "employeeType", "title", "jpegPhoto", "logonCount", "uSNChanged",
+		"whenCreated", "whenChanged", "lastLogonTimestamp")
 
 	objectClassPeople = []string{"top", "staffioPerson" /*"uidObject",*/, "inetOrgPerson"}
 )
@@ -0,0 +1,184 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/liut/staffio-backend/ldap/pool"
+)
+
+// nolint
+var (
+	ErrConflict     = errors.New("Conflict")
+	ErrConstraint   = errors.New("Constraint violation")
+	ErrAccessDenied = errors.New("Insufficient access")
+	ErrUnavailable  = errors.New("Unavailable")
+)
+
+// OpSave operation of Save and SaveGroup, add or modify
+const OpSave = "save"
+
+// Category kind of failure of an operation
+type Category string
+
+// categories, each matches a sentinel error with errors.Is
+const (
+	CategoryUnknown     Category = ""
+	CategoryNotFound    Category = "not-found"            // ErrNotFound
+	CategoryLogin       Category = "invalid-credentials"  // ErrLogin
+	CategoryConflict    Category = "conflict"             // ErrConflict
+	CategoryConstraint  Category = "constraint-violation" // ErrConstraint
+	CategoryAccess      Category = "insufficient-access"  // ErrAccessDenied
+	CategoryUnavailable Category = "unavailable"          // ErrUnavailable
+)
+
+// OpError failed operation on a source, it matches the sentinel error of Category
+// and the wrapped error, such as *ldap.Error, with errors.Is and errors.As
+type OpError struct {
+	Op       string // operation, such as search, bind, save
+	Addr     string // address of source
+	DN       string // target, empty if unknown
+	Code     uint16 // LDAP result code, 0 if not a LDAP error
+	Category Category
+	Err      error
+}
+
+func (e *OpError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("ldap " + e.Op)
+	if e.DN != "" {
+		sb.WriteString(" " + strconv.Quote(e.DN))
+	}
+	if e.Addr != "" {
+		sb.WriteString(" at " + e.Addr)
+	}
+	sb.WriteString(": " + e.Err.Error())
+	return sb.String()
+}
+
+// Unwrap ...
+func (e *OpError) Unwrap() []error {
+	if s := e.Category.sentinel(); s != nil && s != e.Err {
+		return []error{e.Err, s}
+	}
+	return []error{e.Err}
+}
+
+func (c Category) sentinel() error {
+	switch c {
+	case CategoryNotFound:
+		return ErrNotFound
+	case CategoryLogin:
+		return ErrLogin
+	case CategoryConflict:
+		return ErrConflict
+	case CategoryConstraint:
+		return ErrConstraint
+	case CategoryAccess:
+		return ErrAccessDenied
+	case CategoryUnavailable:
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// categoryOf returns category and LDAP result code of err
+func categoryOf(err error) (Category, uint16) {
+	var le *ldap.Error
+	if errors.As(err, &le) {
+		return codeCategory(le.ResultCode), le.ResultCode
+	}
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return CategoryNotFound, 0
+	case errors.Is(err, ErrLogin):
+		return CategoryLogin, 0
+	case errors.Is(err, ErrAccessDenied):
+		return CategoryAccess, 0
+	case errors.Is(err, ErrConflict):
+		return CategoryConflict, 0
+	case errors.Is(err, pool.ErrPoolTimeout), errors.Is(err, pool.ErrBreakerOpen), errors.Is(err, pool.ErrClosed),
+		errors.Is(err, context.DeadlineExceeded):
+		return CategoryUnavailable, 0
+	}
+	return CategoryUnknown, 0
+}
+
+func codeCategory(code uint16) Category {
+	switch code {
+	case ldap.LDAPResultNoSuchObject:
+		return CategoryNotFound
+	case ldap.LDAPResultInvalidCredentials:
+		return CategoryLogin
+	case ldap.LDAPResultEntryAlreadyExists, ldap.LDAPResultAssertionFailed:
+		return CategoryConflict
+	case ldap.LDAPResultConstraintViolation, ldap.LDAPResultObjectClassViolation,
+		ldap.LDAPResultAttributeOrValueExists, ldap.LDAPResultInvalidAttributeSyntax,
+		ldap.LDAPResultUndefinedAttributeType, ldap.LDAPResultNotAllowedOnRDN,
+		ldap.LDAPResultNotAllowedOnNonLeaf, ldap.LDAPResultUnwillingToPerform,
+		ldap.LDAPResultInvalidDNSyntax:
+		return CategoryConstraint
+	case ldap.LDAPResultInsufficientAccessRights, ldap.LDAPResultInappropriateAuthentication,
+		ldap.LDAPResultStrongAuthRequired, ldap.LDAPResultConfidentialityRequired:
+		return CategoryAccess
+	case ldap.LDAPResultBusy, ldap.LDAPResultUnavailable, ldap.LDAPResultTimeLimitExceeded,
+		ldap.ErrorNetwork:
+		return CategoryUnavailable
+	}
+	return CategoryUnknown
+}
+
+// opError wraps err of op on dn as *OpError, nil if err is nil
+func (ls *ldapSource) opError(op, dn string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var oe *OpError
+	if errors.As(err, &oe) {
+		return err
+	}
+	cat, code := categoryOf(err)
+	return &OpError{Op: op, Addr: ls.Addr, DN: dn, Code: code, Category: cat, Err: err}
+}
+
+// MultiError failures of several sources, it matches any of them with errors.Is and errors.As
+type MultiError []error
+
+func (m MultiError) Error() string {
+	parts := make([]string, len(m))
+	for i, err := range m {
+		parts[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors: %s", len(m), strings.Join(parts, "; "))
+}
+
+// Unwrap ...
+func (m MultiError) Unwrap() []error {
+	return m
+}
+
+// bareError returns sentinel if the only source failed with it alone, such as ErrNotFound or ErrLogin,
+// so that a caller comparing with == still works, else as multiError
+func bareError(errs []error, sentinel error) error {
+	var oe *OpError
+	if len(errs) == 1 && errors.As(errs[0], &oe) && oe.Err == sentinel {
+		return sentinel
+	}
+	return multiError(errs)
+}
+
+// multiError returns nil, the only error or a MultiError
+func multiError(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return MultiError(errs)
+}
@@ -0,0 +1,106 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio-backend/ldap/pool"
+)
+
+func TestOpError(t *testing.T) {
+	ls := &ldapSource{Addr: "ldap://fake"}
+	assert.NoError(t, ls.opError(OpSearch, "", nil))
+
+	cases := []struct {
+		err  error
+		cat  Category
+		code uint16
+		is   error
+	}{
+		{fakeError(ldap.LDAPResultNoSuchObject), CategoryNotFound, ldap.LDAPResultNoSuchObject, ErrNotFound},
+		{fakeError(ldap.LDAPResultInvalidCredentials), CategoryLogin, ldap.LDAPResultInvalidCredentials, ErrLogin},
+		{fakeError(ldap.LDAPResultInvalidDNSyntax), CategoryConstraint, ldap.LDAPResultInvalidDNSyntax, ErrConstraint},
+		{fakeError(ldap.LDAPResultEntryAlreadyExists), CategoryConflict, ldap.LDAPResultEntryAlreadyExists, ErrConflict},
+		{fakeError(ldap.LDAPResultConstraintViolation), CategoryConstraint, ldap.LDAPResultConstraintViolation, ErrConstraint},
+		{fakeError(ldap.LDAPResultInsufficientAccessRights), CategoryAccess, ldap.LDAPResultInsufficientAccessRights, ErrAccessDenied},
+		{fakeError(ldap.LDAPResultUnavailable), CategoryUnavailable, ldap.LDAPResultUnavailable, ErrUnavailable},
+		{fakeError(ldap.ErrorNetwork), CategoryUnavailable, ldap.ErrorNetwork, ErrUnavailable},
+		{ErrNotFound, CategoryNotFound, 0, ErrNotFound},
+		{pool.ErrPoolTimeout, CategoryUnavailable, 0, ErrUnavailable},
+		{errors.New("oops"), CategoryUnknown, 0, nil},
+	}
+	for _, c := range cases {
+		err := ls.opError(OpModify, "uid=doe", c.err)
+		var oe *OpError
+		if assert.ErrorAs(t, err, &oe) {
+			assert.Equal(t, OpModify, oe.Op)
+			assert.Equal(t, "ldap://fake", oe.Addr)
+			assert.Equal(t, "uid=doe", oe.DN)
+			assert.Equal(t, c.cat, oe.Category)
+			assert.Equal(t, c.code, oe.Code)
+		}
+		assert.ErrorIs(t, err, c.err)
+		if c.is != nil {
+			assert.ErrorIs(t, err, c.is)
+		}
+		if c.code != 0 {
+			var le *ldap.Error
+			assert.ErrorAs(t, err, &le)
+		}
+		// wrapped only once
+		assert.Equal(t, err, ls.opError(OpSearch, "", err))
+	}
+
+	err := ls.opError(OpBind, "uid=doe", ErrLogin)
+	assert.Equal(t, `ldap bind "uid=doe" at ldap://fake: Incorrect Username/Password`, err.Error())
+	assert.Len(t, err.(*OpError).Unwrap(), 1)
+}
+
+func TestMultiError(t *testing.T) {
+	assert.NoError(t, multiError(nil))
+	assert.Equal(t, ErrLogin, multiError([]error{ErrLogin}))
+
+	dir1, dir2 := newFakeDirectory(), newFakeDirectory()
+	dir2.addPeople("doe", "secret")
+	ls1, ls2 := dir1.newSource(), dir2.newSource()
+	ls2.Addr = "ldap://fake2"
+	s := &Store{sources: []*ldapSource{ls1, ls2}}
+	defer s.Close()
+
+	_, err := s.Get("nobody")
+	assert.ErrorIs(t, err, ErrNotFound)
+	var me MultiError
+	if assert.ErrorAs(t, err, &me) && assert.Len(t, me, 2) {
+		var oe *OpError
+		if assert.ErrorAs(t, me[1], &oe) {
+			assert.Equal(t, OpSearch, oe.Op)
+			assert.Equal(t, "ldap://fake2", oe.Addr)
+			assert.Equal(t, ls2.UDN("nobody"), oe.DN)
+		}
+	}
+	assert.Contains(t, err.Error(), "2 errors: ")
+
+	_, err = s.Authenticate("doe", "bad")
+	assert.ErrorIs(t, err, ErrLogin)
+	var oe *OpError
+	assert.ErrorAs(t, err, &oe)
+
+	_, err = s.Authenticate("doe", "secret")
+	assert.NoError(t, err)
+
+	// the bare sentinel of a single source, for callers comparing with ==
+	s1 := &Store{sources: []*ldapSource{ls2}}
+	_, err = s1.Get("nobody")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = s1.GetByDN(ls2.UDN("nobody"))
+	assert.Equal(t, ErrNotFound, err)
+	_, err = s1.Authenticate("doe", "bad")
+	assert.Equal(t, ErrLogin, err)
+	dir2.breakConns()
+	ls2.cp.Close()
+	_, err = s1.Get("doe")
+	assert.ErrorAs(t, err, &oe, "other failures keep the details")
+}
@@ -0,0 +1,561 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/liut/staffio-backend/ldap/pool"
+	"github.com/liut/staffio-backend/passwd"
+)
+
+// an in-memory directory for unit tests without a LDAP server
+
+const (
+	fakeBase    = "dc=example,dc=org"
+	fakeAdminDN = "cn=admin," + fakeBase
+	fakeAdminPW = "admin"
+)
+
+type fakeCall struct {
+	op string
+	dn string
+	by string // bound dn of the connection
+}
+
+type fakeDirectory struct {
+	mu         sync.Mutex
+	entries    map[string]map[string][]string // lower dn: lower attr name: values
+	names      map[string]string              // lower dn: dn
+	extensions []string
+	controls   []string
+	mustChange map[string]bool // lower dn: changeAfterReset of ppolicy
+	csn        int             // last entryCSN
+	calls      []fakeCall
+	dials      int
+	dialErr    error
+	poolSize   int // of each pool of newSource, default 2
+	observer   Observer
+	clients    []*fakeClient
+}
+
+func newFakeDirectory() *fakeDirectory {
+	d := &fakeDirectory{
+		entries:    make(map[string]map[string][]string),
+		names:      make(map[string]string),
+		extensions: []string{oidPasswordModify},
+	}
+	d.put(fakeBase, map[string][]string{"objectClass": {"domain", "top"}, "dc": {"example"}})
+	d.put(fakeAdminDN, map[string][]string{"objectClass": {"person"}, "cn": {"admin"}, "userPassword": {fakeAdminPW}})
+	d.put(etParent.DN("people", fakeBase), map[string][]string{"objectClass": {"organizationalUnit"}, "ou": {"people"}})
+	d.put(etParent.DN("groups", fakeBase), map[string][]string{"objectClass": {"organizationalUnit"}, "ou": {"groups"}})
+	return d
+}
+
+func (d *fakeDirectory) put(dn string, attrs map[string][]string) {
+	m := make(map[string][]string, len(attrs))
+	for k, v := range attrs {
+		m[strings.ToLower(k)] = append([]string(nil), v...)
+	}
+	d.entries[strings.ToLower(dn)] = m
+	d.names[strings.ToLower(dn)] = dn
+	d.touch(m)
+}
+
+// touch changes entryCSN of e
+func (d *fakeDirectory) touch(e map[string][]string) {
+	d.csn++
+	e["entrycsn"] = []string{fmt.Sprintf("20240101000000.%06dZ#000000#000#000000", d.csn)}
+}
+
+func (d *fakeDirectory) get(dn string) map[string][]string {
+	return d.entries[strings.ToLower(dn)]
+}
+
+// attr returns the first value of attribute name of dn
+func (d *fakeDirectory) attr(dn, name string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e := d.get(dn); e != nil && len(e[strings.ToLower(name)]) > 0 {
+		return e[strings.ToLower(name)][0]
+	}
+	return ""
+}
+
+func (d *fakeDirectory) addPeople(uid, password string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dn := etPeople.DN(uid, fakeBase)
+	hashed, _ := passwd.Hash(passwd.SchemeSSHA, password)
+	d.put(dn, map[string][]string{
+		"objectClass":  objectClassPeople,
+		"uid":          {uid},
+		"cn":           {uid},
+		"sn":           {uid},
+		"userPassword": {hashed},
+	})
+	return dn
+}
+
+func (d *fakeDirectory) callsOf(op string) (calls []fakeCall) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range d.calls {
+		if c.op == op {
+			calls = append(calls, c)
+		}
+	}
+	return
+}
+
+func (d *fakeDirectory) dial() (ldap.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dials++
+	if d.dialErr != nil {
+		return nil, d.dialErr
+	}
+	c := &fakeClient{dir: d}
+	d.clients = append(d.clients, c)
+	return observeClient(c, "ldap://fake", d.observer), nil
+}
+
+// breakConns half-closes the dialed connections, operations fail with network error
+func (d *fakeDirectory) breakConns() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range d.clients {
+		c.broken = true
+	}
+}
+
+// newSource returns a source with a pool of the fake directory
+func (d *fakeDirectory) newSource() *ldapSource {
+	size := d.poolSize
+	if size == 0 {
+		size = 2
+	}
+	cb := pool.NewBreaker("ldap://fake", &pool.BreakerOptions{Threshold: 1, BaseDelay: time.Minute})
+	return &ldapSource{
+		Addr:   "ldap://fake",
+		Base:   fakeBase,
+		BindDN: fakeAdminDN,
+		Passwd: fakeAdminPW,
+		cp: pool.NewPool(&pool.Options{
+			Factory:     d.dial,
+			PoolSize:    size,
+			PoolTimeout: time.Second,
+			Breaker:     cb,
+		}),
+		ap: pool.NewPool(&pool.Options{
+			Factory:     d.dial,
+			PoolSize:    size,
+			PoolTimeout: time.Second,
+			Breaker:     cb,
+		}),
+		cb:        cb,
+		pwdScheme: passwd.DefaultScheme,
+		pwdExt:    new(int32),
+		assertCtl: new(int32),
+	}
+}
+
+// fakeClient unimplemented methods of ldap.Client panic
+type fakeClient struct {
+	ldap.Client
+
+	dir        *fakeDirectory
+	boundDN    string
+	closed     bool
+	broken     bool
+	restricted bool // bound with a password must be changed
+}
+
+func fakeError(code uint16) error {
+	return ldap.NewError(code, errors.New(ldap.LDAPResultCodeMap[code]))
+}
+
+func (c *fakeClient) record(op, dn string) {
+	c.dir.calls = append(c.dir.calls, fakeCall{op: op, dn: dn, by: c.boundDN})
+}
+
+func (c *fakeClient) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *fakeClient) IsClosing() bool {
+	return c.closed
+}
+
+func (c *fakeClient) Bind(username, password string) error {
+	_, err := c.SimpleBind(ldap.NewSimpleBindRequest(username, password, nil))
+	return err
+}
+
+func (c *fakeClient) SimpleBind(req *ldap.SimpleBindRequest) (*ldap.SimpleBindResult, error) {
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	if c.broken {
+		return nil, fakeError(ldap.ErrorNetwork)
+	}
+	c.boundDN = ""
+	c.restricted = false
+	c.record("bind", req.Username)
+	r := &ldap.SimpleBindResult{}
+	e := c.dir.get(req.Username)
+	if e == nil {
+		return r, fakeError(ldap.LDAPResultInvalidCredentials)
+	}
+	for _, hashed := range e["userpassword"] {
+		if ok, _ := passwd.Verify(hashed, req.Password); ok {
+			c.boundDN = c.dir.names[strings.ToLower(req.Username)]
+			if c.dir.mustChange[strings.ToLower(req.Username)] {
+				c.restricted = true
+				pc := ldap.NewControlBeheraPasswordPolicy()
+				pc.Error = ldap.BeheraChangeAfterReset
+				r.Controls = append(r.Controls, pc)
+			}
+			return r, nil
+		}
+	}
+	return r, fakeError(ldap.LDAPResultInvalidCredentials)
+}
+
+func (c *fakeClient) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	if c.broken {
+		return nil, fakeError(ldap.ErrorNetwork)
+	}
+	c.record("search", req.BaseDN)
+	if c.restricted {
+		return nil, fakeError(ldap.LDAPResultUnwillingToPerform)
+	}
+	sr := new(ldap.SearchResult)
+	if req.BaseDN == "" && req.Scope == ldap.ScopeBaseObject {
+		sr.Entries = append(sr.Entries, ldap.NewEntry("", map[string][]string{
+			"supportedExtension": c.dir.extensions,
+			"supportedControl":   c.dir.controls,
+		}))
+		return sr, nil
+	}
+	base := strings.ToLower(req.BaseDN)
+	if c.dir.entries[base] == nil {
+		return nil, fakeError(ldap.LDAPResultNoSuchObject)
+	}
+	f, err := parseFakeFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	var dns []string
+	for dn := range c.dir.entries {
+		if dn == base || req.Scope != ldap.ScopeBaseObject && strings.HasSuffix(dn, ","+base) {
+			dns = append(dns, dn)
+		}
+	}
+	sort.Strings(dns)
+	for _, dn := range dns {
+		e := c.dir.entries[dn]
+		if !f.match(e) {
+			continue
+		}
+		attrs := make(map[string][]string)
+		for k, v := range e {
+			if k == "userpassword" {
+				continue
+			}
+			for _, name := range req.Attributes {
+				if strings.EqualFold(name, k) {
+					attrs[name] = v
+				}
+			}
+			if len(req.Attributes) == 0 {
+				attrs[k] = v
+			}
+		}
+		sr.Entries = append(sr.Entries, ldap.NewEntry(c.dir.names[dn], attrs))
+	}
+	return sr, nil
+}
+
+func (c *fakeClient) SearchWithPaging(req *ldap.SearchRequest, pagingSize uint32) (*ldap.SearchResult, error) {
+	return c.Search(req)
+}
+
+func (c *fakeClient) Add(req *ldap.AddRequest) error {
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	c.record("add", req.DN)
+	if c.boundDN == "" {
+		return fakeError(ldap.LDAPResultInsufficientAccessRights)
+	}
+	if c.dir.get(req.DN) != nil {
+		return fakeError(ldap.LDAPResultEntryAlreadyExists)
+	}
+	attrs := make(map[string][]string)
+	for _, a := range req.Attributes {
+		attrs[a.Type] = a.Vals
+	}
+	c.dir.put(req.DN, attrs)
+	return nil
+}
+
+func (c *fakeClient) Del(req *ldap.DelRequest) error {
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	c.record("del", req.DN)
+	if c.boundDN == "" {
+		return fakeError(ldap.LDAPResultInsufficientAccessRights)
+	}
+	if c.dir.get(req.DN) == nil {
+		return fakeError(ldap.LDAPResultNoSuchObject)
+	}
+	delete(c.dir.entries, strings.ToLower(req.DN))
+	delete(c.dir.names, strings.ToLower(req.DN))
+	return nil
+}
+
+func (c *fakeClient) Modify(req *ldap.ModifyRequest) error {
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	c.record("modify", req.DN)
+	if c.broken {
+		return fakeError(ldap.ErrorNetwork)
+	}
+	if c.boundDN == "" {
+		return fakeError(ldap.LDAPResultInsufficientAccessRights)
+	}
+	e := c.dir.get(req.DN)
+	if e == nil {
+		return fakeError(ldap.LDAPResultNoSuchObject)
+	}
+	for _, ctl := range req.Controls {
+		if ca, ok := ctl.(*controlAssertion); ok {
+			if !fakeContains(c.dir.controls, oidAssertion) {
+				return fakeError(ldap.LDAPResultUnavailableCriticalExtension)
+			}
+			f, err := parseFakeFilter(ca.str)
+			if err != nil {
+				return err
+			}
+			if !f.match(e) {
+				return fakeError(ldap.LDAPResultAssertionFailed)
+			}
+		}
+	}
+	defer c.dir.touch(e)
+	for _, ch := range req.Changes {
+		name := strings.ToLower(ch.Modification.Type)
+		switch ch.Operation {
+		case ldap.AddAttribute:
+			e[name] = append(e[name], ch.Modification.Vals...)
+		case ldap.ReplaceAttribute:
+			if len(ch.Modification.Vals) == 0 {
+				delete(e, name)
+			} else {
+				e[name] = append([]string(nil), ch.Modification.Vals...)
+			}
+		case ldap.DeleteAttribute:
+			if len(ch.Modification.Vals) == 0 {
+				delete(e, name)
+				continue
+			}
+			var kept []string
+			for _, v := range e[name] {
+				if !fakeContains(ch.Modification.Vals, v) {
+					kept = append(kept, v)
+				}
+			}
+			e[name] = kept
+		case ldap.IncrementAttribute:
+			if len(e[name]) != 1 {
+				return fakeError(ldap.LDAPResultNoSuchAttribute)
+			}
+			n, _ := strconv.Atoi(e[name][0])
+			delta, _ := strconv.Atoi(ch.Modification.Vals[0])
+			e[name] = []string{strconv.Itoa(n + delta)}
+		}
+	}
+	return nil
+}
+
+func (c *fakeClient) PasswordModify(req *ldap.PasswordModifyRequest) (*ldap.PasswordModifyResult, error) {
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	c.record("passwd", req.UserIdentity)
+	if !fakeContains(c.dir.extensions, oidPasswordModify) {
+		return nil, fakeError(ldap.LDAPResultProtocolError)
+	}
+	if c.boundDN == "" {
+		return nil, fakeError(ldap.LDAPResultUnwillingToPerform)
+	}
+	dn := req.UserIdentity
+	if dn == "" {
+		dn = c.boundDN
+	}
+	if !strings.EqualFold(dn, c.boundDN) && !strings.EqualFold(c.boundDN, fakeAdminDN) {
+		return nil, fakeError(ldap.LDAPResultInsufficientAccessRights)
+	}
+	e := c.dir.get(dn)
+	if e == nil {
+		return nil, fakeError(ldap.LDAPResultNoSuchObject)
+	}
+	if req.OldPassword != "" {
+		var ok bool
+		for _, hashed := range e["userpassword"] {
+			if ok, _ = passwd.Verify(hashed, req.OldPassword); ok {
+				break
+			}
+		}
+		if !ok {
+			return nil, fakeError(ldap.LDAPResultUnwillingToPerform)
+		}
+	}
+	if len(req.NewPassword) < 3 { // a tiny quality check of server
+		return nil, fakeError(ldap.LDAPResultConstraintViolation)
+	}
+	hashed, _ := passwd.Hash(passwd.SchemeSSHA, req.NewPassword)
+	e["userpassword"] = []string{hashed}
+	delete(c.dir.mustChange, strings.ToLower(dn))
+	c.restricted = false
+	return &ldap.PasswordModifyResult{}, nil
+}
+
+func fakeContains(arr []string, s string) bool {
+	for _, v := range arr {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeFilter a tiny subset of RFC 4515 filters
+type fakeFilter struct {
+	op       byte // & | ! = > < *
+	attr     string
+	value    string
+	children []*fakeFilter
+}
+
+func parseFakeFilter(s string) (*fakeFilter, error) {
+	f, rest, err := parseFakeFilterAt(s)
+	if err == nil && rest != "" {
+		err = errors.New("fake filter: trailing " + rest)
+	}
+	return f, err
+}
+
+func parseFakeFilterAt(s string) (*fakeFilter, string, error) {
+	if len(s) < 2 || s[0] != '(' {
+		return nil, s, errors.New("fake filter: bad " + s)
+	}
+	s = s[1:]
+	switch s[0] {
+	case '&', '|', '!':
+		f := &fakeFilter{op: s[0]}
+		s = s[1:]
+		for len(s) > 0 && s[0] == '(' {
+			child, rest, err := parseFakeFilterAt(s)
+			if err != nil {
+				return nil, s, err
+			}
+			f.children = append(f.children, child)
+			s = rest
+		}
+		if len(s) == 0 || s[0] != ')' {
+			return nil, s, errors.New("fake filter: unclosed")
+		}
+		return f, s[1:], nil
+	}
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, s, errors.New("fake filter: unclosed")
+	}
+	item, rest := s[:end], s[end+1:]
+	f := &fakeFilter{op: '='}
+	i := strings.IndexByte(item, '=')
+	if i <= 0 {
+		return nil, s, errors.New("fake filter: bad item " + item)
+	}
+	f.attr, f.value = strings.ToLower(item[:i]), item[i+1:]
+	switch f.attr[len(f.attr)-1] {
+	case '>', '<':
+		f.op = f.attr[len(f.attr)-1]
+		f.attr = f.attr[:len(f.attr)-1]
+	}
+	if f.op == '=' && strings.Contains(f.value, "*") {
+		f.op = '*'
+	}
+	f.value = fakeUnescape(f.value)
+	return f, rest, nil
+}
+
+func fakeUnescape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+2 < len(s) {
+			if b, err := hex.DecodeString(s[i+1 : i+3]); err == nil {
+				sb.Write(b)
+				i += 2
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+func (f *fakeFilter) match(e map[string][]string) bool {
+	switch f.op {
+	case '&':
+		for _, c := range f.children {
+			if !c.match(e) {
+				return false
+			}
+		}
+		return true
+	case '|':
+		for _, c := range f.children {
+			if c.match(e) {
+				return true
+			}
+		}
+		return false
+	case '!':
+		return len(f.children) == 1 && !f.children[0].match(e)
+	}
+	for _, v := range e[f.attr] {
+		switch f.op {
+		case '=':
+			if strings.EqualFold(v, f.value) {
+				return true
+			}
+		case '>':
+			if strings.ToLower(v) >= strings.ToLower(f.value) {
+				return true
+			}
+		case '<':
+			if strings.ToLower(v) <= strings.ToLower(f.value) {
+				return true
+			}
+		case '*':
+			if f.value == "*" {
+				return true
+			}
+			if ok, _ := path.Match(strings.ToLower(f.value), strings.ToLower(v)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -4,6 +4,8 @@ import (
 	"strings"
 
 	"github.com/go-ldap/ldap/v3"
+
+	"github.com/liut/staffio-backend/audit"
 )
 
 const (
@@ -17,19 +19,23 @@ var (
 
 // AllGroup ...
 func (s *Store) AllGroup() (data []Group, err error) {
-	for _, ls := range s.sources {
+	var errs []error
+	for _, ls := range s.available() {
 		data, err = ls.SearchGroup("")
 		if err == nil {
 			return
 		}
+		errs = append(errs, ls.opError(OpSearch, ls.Base, err))
 	}
+	err = multiError(errs)
 	return
 }
 
 // GetGroup ...
 func (s *Store) GetGroup(name string) (group *Group, err error) {
 	// debug("Search group %s", name)
-	for _, ls := range s.sources {
+	var errs []error
+	for _, ls := range s.available() {
 		var entry *ldap.Entry
 		entry, err = ls.getGroupEntry(name)
 		if err == nil {
@@ -37,9 +43,10 @@ func (s *Store) GetGroup(name string) (group *Group, err error) {
 			return
 		}
 		logger().Infow("search group fail", "name", name, "addr", ls.Addr, "err", err)
+		errs = append(errs, ls.opError(OpSearch, ls.groupDN(name), err))
 	}
 	logger().Debugw("group not found", "name", name)
-	if err == nil {
+	if err = multiError(errs); err == nil {
 		err = ErrNotFound
 	}
 	return
@@ -90,6 +97,13 @@ func (ls *ldapSource) SearchGroup(name string) (data []Group, err error) {
 	return
 }
 
+func (ls *ldapSource) groupDN(name string) string {
+	if ls.isAD {
+		return etADgroup.DN(name, ls.Base)
+	}
+	return etGroup.DN(name, ls.Base)
+}
+
 func entryToGroup(entry *ldap.Entry) (g *Group) {
 	g = new(Group)
 	for _, attr := range entry.Attributes {
@@ -102,17 +116,27 @@ func entryToGroup(entry *ldap.Entry) (g *Group) {
 			}
 		}
 	}
+	g.Version, _ = versionOf(entry)
 	// debug("group %q", g)
 	return
 }
 
 // SaveGroup ...
-func (s *Store) SaveGroup(group *Group) error {
-	for _, ls := range s.sources {
-		err := ls.saveGroup(group)
+func (s *Store) SaveGroup(group *Group) (err error) {
+	var before *Group
+	if s.audit != nil {
+		before, _ = s.GetGroup(group.Name)
+	}
+	defer func() { s.emit(audit.ActionSaveGroup, group.Name, audit.Diff(before, group), err) }()
+	sources, err := s.writable(OpSave)
+	if err != nil {
+		return err
+	}
+	for _, ls := range sources {
+		err = ls.saveGroup(group)
 		if err != nil {
 			logger().Infow("saveGroup fail", "group", group, "err", err)
-			return err
+			return ls.opError(OpSave, ls.groupDN(group.Name), err)
 		}
 	}
 	return nil
@@ -122,18 +146,22 @@ func (ls *ldapSource) saveGroup(group *Group) error {
 	if ls.isAD {
 		return ErrUnsupport
 	}
+	useAssert := group.Version != "" && ls.useAssertion()
 	err := ls.opWithMan(func(c ldap.Client) error {
 		gdn := etGroup.DN(group.Name, ls.Base)
 		var members []string
 		for _, m := range group.Members {
 			members = append(members, ls.UDN(m))
 		}
-		_, err := ldapFindOne(c, gdn, etGroup.Filter, etGroup.Attributes...)
+		entry, err := ldapFindOne(c, gdn, etGroup.Filter, etGroup.Attributes...)
 		if err == nil { // update
 			mr := ldap.NewModifyRequest(gdn, nil)
+			if mr.Controls, err = expectVersion(entry, group.Version, useAssert); err != nil {
+				return err
+			}
 			mr.Replace("member", members)
 			logger().Debugw("change group", "mr", mr)
-			err = c.Modify(mr)
+			err = versionError(c.Modify(mr))
 		}
 		if err == ErrNotFound { // create
 			ar := ldap.NewAddRequest(gdn, nil)
@@ -152,12 +180,21 @@ func (ls *ldapSource) saveGroup(group *Group) error {
 }
 
 // EraseGroup ...
-func (s *Store) EraseGroup(name string) error {
-	for _, ls := range s.sources {
-		err := ls.eraseGroup(name)
+func (s *Store) EraseGroup(name string) (err error) {
+	var before *Group
+	if s.audit != nil {
+		before, _ = s.GetGroup(name)
+	}
+	defer func() { s.emit(audit.ActionEraseGroup, name, audit.Diff(before, nil), err) }()
+	sources, err := s.writable(OpDelete)
+	if err != nil {
+		return err
+	}
+	for _, ls := range sources {
+		err = ls.eraseGroup(name)
 		if err != nil {
 			logger().Infow("eraseGroup fail", "name", name, "err", err)
-			return err
+			return ls.opError(OpDelete, ls.groupDN(name), err)
 		}
 	}
 	return nil
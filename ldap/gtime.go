@@ -0,0 +1,180 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// nolint
+var (
+	ErrInvalidTime = errors.New("invalid time")
+)
+
+// fileTimeOffset seconds from 1601-01-01 UTC, zero of Windows FILETIME, to the Unix epoch
+const fileTimeOffset = 11644473600
+
+// fileTimeNever value of FILETIME attributes meaning never, such as accountExpires
+const fileTimeNever = math.MaxInt64
+
+// ParseGeneralizedTime parses GeneralizedTime of RFC 4517, such as 20230101120000Z,
+// 20230101120000.0Z (Active Directory), 202301011200+0800 or 2023010112,5Z.
+// A fraction applies to the last of hour, minute or second present.
+// see also: https://tools.ietf.org/html/rfc4517#section-3.3.13
+func ParseGeneralizedTime(s string) (time.Time, error) {
+	invalid := func() (time.Time, error) {
+		return time.Time{}, fmt.Errorf("%w: generalized time %q", ErrInvalidTime, s)
+	}
+	num := func(i, n int) (int, bool) {
+		if i+n > len(s) {
+			return 0, false
+		}
+		v := 0
+		for _, c := range s[i : i+n] {
+			if c < '0' || c > '9' {
+				return 0, false
+			}
+			v = v*10 + int(c-'0')
+		}
+		return v, true
+	}
+
+	year, ok1 := num(0, 4)
+	month, ok2 := num(4, 2)
+	day, ok3 := num(6, 2)
+	hour, ok4 := num(8, 2)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return invalid()
+	}
+	i := 10
+	minute, sec := 0, 0
+	unit := time.Hour
+	if v, ok := num(i, 2); ok {
+		minute, unit, i = v, time.Minute, i+2
+		if v, ok = num(i, 2); ok {
+			sec, unit, i = v, time.Second, i+2
+		}
+	}
+
+	var frac time.Duration
+	if i < len(s) && (s[i] == '.' || s[i] == ',') {
+		j := i + 1
+		for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			j++
+		}
+		if j == i+1 {
+			return invalid()
+		}
+		f, err := strconv.ParseFloat("0."+s[i+1:j], 64)
+		if err != nil {
+			return invalid()
+		}
+		frac = time.Duration(math.Round(f * float64(unit)))
+		i = j
+	}
+
+	// g-time-zone is required
+	if i >= len(s) {
+		return invalid()
+	}
+	loc := time.UTC
+	switch s[i] {
+	case 'Z':
+		i++
+	case '+', '-':
+		sign := 1
+		if s[i] == '-' {
+			sign = -1
+		}
+		zh, ok := num(i+1, 2)
+		if !ok || zh > 23 {
+			return invalid()
+		}
+		offset := zh * 3600
+		i += 3
+		if zm, ok := num(i, 2); ok {
+			if zm > 59 {
+				return invalid()
+			}
+			offset += zm * 60
+			i += 2
+		}
+		loc = time.FixedZone("", sign*offset)
+	default:
+		return invalid()
+	}
+	if i != len(s) {
+		return invalid()
+	}
+
+	// sec 60 is a leap second
+	if month < 1 || month > 12 || day < 1 || hour > 23 || minute > 59 || sec > 60 {
+		return invalid()
+	}
+	t := time.Date(year, time.Month(month), day, hour, minute, sec, 0, loc)
+	if t.Day() != day && sec != 60 {
+		return invalid()
+	}
+	return t.Add(frac), nil
+}
+
+// FormatGeneralizedTime formats t as GeneralizedTime in UTC with precision of second
+func FormatGeneralizedTime(t time.Time) string {
+	return t.UTC().Format(TimeLayout)
+}
+
+// ParseFileTime parses a Windows FILETIME of Active Directory, such as lastLogonTimestamp and pwdLastSet,
+// 100-nanosecond intervals since 1601-01-01 UTC in decimal.
+// 0 and the max value mean never, a zero time is returned.
+func ParseFileTime(s string) (time.Time, error) {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return time.Time{}, fmt.Errorf("%w: file time %q", ErrInvalidTime, s)
+	}
+	if v == 0 || v == fileTimeNever {
+		return time.Time{}, nil
+	}
+	const perSecond = int64(time.Second / 100)
+	return time.Unix(v/perSecond-fileTimeOffset, v%perSecond*100).UTC(), nil
+}
+
+// FormatFileTime formats t as a Windows FILETIME, 0 for a zero time
+func FormatFileTime(t time.Time) string {
+	secs := t.Unix() + fileTimeOffset
+	if t.IsZero() || secs < 0 {
+		return "0"
+	}
+	return strconv.FormatInt(secs*int64(time.Second/100)+int64(t.Nanosecond()/100), 10)
+}
+
+// timeOf returns the time of the first attribute present and valid,
+// GeneralizedTime or FILETIME if fileTime
+func timeOf(entry *ldap.Entry, fileTime bool, names ...string) *time.Time {
+	for _, name := range names {
+		str := entry.GetAttributeValue(name)
+		if str == "" {
+			continue
+		}
+		var (
+			t   time.Time
+			err error
+		)
+		if fileTime {
+			t, err = ParseFileTime(str)
+		} else {
+			t, err = ParseGeneralizedTime(str)
+		}
+		if err != nil {
+			logger().Infow("invalid time", "dn", entry.DN, "attr", name, "err", err)
+			continue
+		}
+		if !t.IsZero() {
+			return &t
+		}
+	}
+	return nil
+}
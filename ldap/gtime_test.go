@@ -0,0 +1,105 @@
+package ldap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGeneralizedTime(t *testing.T) {
+	utc := func(y int, mo time.Month, d, h, mi, s, ns int) time.Time {
+		return time.Date(y, mo, d, h, mi, s, ns, time.UTC)
+	}
+	cases := map[string]time.Time{
+		"20230101120000Z":           utc(2023, 1, 1, 12, 0, 0, 0),
+		"20230101120000.0Z":         utc(2023, 1, 1, 12, 0, 0, 0),
+		"20230101120000.123456Z":    utc(2023, 1, 1, 12, 0, 0, 123456000),
+		"20230101120000,5Z":         utc(2023, 1, 1, 12, 0, 0, 500000000),
+		"202301011230Z":             utc(2023, 1, 1, 12, 30, 0, 0),
+		"202301011230.5Z":           utc(2023, 1, 1, 12, 30, 30, 0),
+		"2023010112Z":               utc(2023, 1, 1, 12, 0, 0, 0),
+		"2023010112.25Z":            utc(2023, 1, 1, 12, 15, 0, 0),
+		"20230101200000+0800":       utc(2023, 1, 1, 12, 0, 0, 0),
+		"20230101070000-05":         utc(2023, 1, 1, 12, 0, 0, 0),
+		"20230101063000.5-0530":     utc(2023, 1, 1, 12, 0, 0, 500000000),
+		"20161231235960Z":           utc(2017, 1, 1, 0, 0, 0, 0),
+		"20240229000000Z":           utc(2024, 2, 29, 0, 0, 0, 0),
+		"20230101120000.999999999Z": utc(2023, 1, 1, 12, 0, 0, 999999999),
+	}
+	for s, want := range cases {
+		got, err := ParseGeneralizedTime(s)
+		if assert.NoError(t, err, s) {
+			assert.True(t, want.Equal(got), "%s: %s", s, got)
+		}
+	}
+	got, _ := ParseGeneralizedTime("20230101200000+0800")
+	_, offset := got.Zone()
+	assert.Equal(t, 8*3600, offset)
+
+	for _, s := range []string{
+		"", "2023", "20230101", "20230101120000", "2023010112000Z", "20230101120000.Z",
+		"20231301120000Z", "20230230120000Z", "20230101240000Z", "20230101126000Z",
+		"20230101120000+2400", "20230101120000+0860", "20230101120000+8", "20230101120000ZZ",
+		"20230101120000 Z", "x0230101120000Z",
+	} {
+		_, err := ParseGeneralizedTime(s)
+		assert.ErrorIs(t, err, ErrInvalidTime, s)
+	}
+
+	local := time.Date(2023, 1, 1, 20, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	assert.Equal(t, "20230101120000Z", FormatGeneralizedTime(local))
+	got, err := ParseGeneralizedTime(FormatGeneralizedTime(local))
+	assert.NoError(t, err)
+	assert.True(t, local.Equal(got))
+}
+
+func TestFileTime(t *testing.T) {
+	got, err := ParseFileTime("133170048000000000")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), got)
+	got, err = ParseFileTime("116444736000000001")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(0, 100).UTC(), got)
+	assert.Equal(t, "133170048000000000", FormatFileTime(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "116444736000000001", FormatFileTime(time.Unix(0, 100)))
+
+	for _, s := range []string{"0", "9223372036854775807"} {
+		got, err = ParseFileTime(s)
+		assert.NoError(t, err)
+		assert.True(t, got.IsZero(), s)
+	}
+	assert.Equal(t, "0", FormatFileTime(time.Time{}))
+	_, err = ParseFileTime("-1")
+	assert.ErrorIs(t, err, ErrInvalidTime)
+	_, err = ParseFileTime("20230101120000.0Z")
+	assert.ErrorIs(t, err, ErrInvalidTime)
+}
+
+func TestEntryTimes(t *testing.T) {
+	u := entryToPeople(ldap.NewEntry("CN=doe,CN=Users,DC=example,DC=org", map[string][]string{
+		"sAMAccountName": {"doe"},
+		"whenCreated":    {"20230101120000.0Z"},
+		"whenChanged":    {"20230102120000.0Z"},
+	}))
+	if assert.NotNil(t, u.Created) && assert.NotNil(t, u.Modified) {
+		assert.Equal(t, time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC), *u.Created)
+		assert.Equal(t, time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC), *u.Modified)
+	}
+
+	u = entryToPeople(ldap.NewEntry("uid=doe", map[string][]string{
+		"createdTime":     {"bad"},
+		"createTimestamp": {"20230101200000+0800"},
+		"modifyTimestamp": {"20230101120000.5Z"},
+	}))
+	if assert.NotNil(t, u.Created) && assert.NotNil(t, u.Modified) {
+		assert.True(t, time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC).Equal(*u.Created))
+		assert.Equal(t, 500*time.Millisecond, u.Modified.Sub(*u.Created))
+	}
+
+	assert.Nil(t, timeOf(ldap.NewEntry("uid=doe", map[string][]string{"pwdLastSet": {"0"}}), true, "pwdLastSet"))
+	if pls := timeOf(ldap.NewEntry("uid=doe", map[string][]string{"pwdLastSet": {"133170048000000000"}}), true, "pwdLastSet"); assert.NotNil(t, pls) {
+		assert.Equal(t, 2023, pls.Year())
+	}
+}
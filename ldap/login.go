@@ -0,0 +1,103 @@
+package ldap
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// attributes of login recorded by RecordLogins
+const (
+	attrLastLogin  = "lastLoginTime"
+	attrLoginCount = "loginCount"
+)
+
+// loginOf returns the latest login and count of logins tracked by the directory or recorded by RecordLogins:
+// authTimestamp of the lastbind overlay, lastLogonTimestamp and logonCount of Active Directory
+func loginOf(entry *ldap.Entry) (last *time.Time, count int) {
+	for _, t := range []*time.Time{
+		timeOf(entry, false, "authTimestamp"),
+		timeOf(entry, false, attrLastLogin),
+		timeOf(entry, true, "lastLogonTimestamp"),
+	} {
+		if t != nil && (last == nil || t.After(*last)) {
+			last = t
+		}
+	}
+	for _, name := range []string{"logonCount", attrLoginCount} {
+		if str := entry.GetAttributeValue(name); str != "" {
+			count, _ = strconv.Atoi(str)
+			break
+		}
+	}
+	return
+}
+
+// recordLogin writes the login of staff on sources with RecordLogins, a failure is logged only,
+// the count is incremented by the server (RFC 4525) so that concurrent logins are not lost
+func (s *Store) recordLogin(staff *People) {
+	now := time.Now()
+	recorded := false
+	for _, ls := range s.available() {
+		if !ls.recordLogins || ls.isAD {
+			continue
+		}
+		dn := ls.UDN(staff.UID)
+		var entry *ldap.Entry
+		err := ls.opWithMan(func(c ldap.Client) (err error) {
+			if err = c.Modify(loginRequest(dn, now, false)); ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchAttribute) {
+				// first login recorded
+				err = c.Modify(loginRequest(dn, now, true))
+			}
+			if err != nil {
+				return
+			}
+			// the version of entry changed
+			entry, _ = ldapFindOne(c, dn, etPeople.Filter, append([]string{attrLoginCount}, versionAttrs...)...)
+			return nil
+		})
+		if err != nil {
+			logger().Infow("record login fail", "dn", dn, "err", err)
+			continue
+		}
+		if !recorded && entry != nil {
+			if staff.Version != "" {
+				staff.Version, _ = versionOf(entry)
+			}
+			staff.LogonCount, _ = strconv.Atoi(entry.GetAttributeValue(attrLoginCount))
+		}
+		recorded = true
+	}
+	if recorded {
+		staff.LastLogin = &now
+	}
+}
+
+// loginRequest returns a request of the login at t, adds loginCount if missing
+func loginRequest(dn string, t time.Time, missing bool) *ldap.ModifyRequest {
+	mr := ldap.NewModifyRequest(dn, nil)
+	mr.Replace(attrLastLogin, []string{FormatGeneralizedTime(t)})
+	if missing {
+		mr.Add(attrLoginCount, []string{"1"})
+	} else {
+		mr.Increment(attrLoginCount, "1")
+	}
+	return mr
+}
+
+// loginFilter returns the condition of InactiveSince in spec, no login since the time or never
+func (ls *ldapSource) loginFilter(spec *Spec) string {
+	if spec.InactiveSince == nil {
+		return ""
+	}
+	if ls.isAD {
+		// lastLogonTimestamp is replicated lazily, up to 14 days behind
+		return "(!(lastLogonTimestamp>=" + FormatFileTime(*spec.InactiveSince) + "))"
+	}
+	name := "authTimestamp"
+	if ls.recordLogins {
+		name = attrLastLogin
+	}
+	return "(!(" + name + ">=" + FormatGeneralizedTime(*spec.InactiveSince) + "))"
+}
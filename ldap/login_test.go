@@ -0,0 +1,129 @@
+package ldap
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginOf(t *testing.T) {
+	last, count := loginOf(ldap.NewEntry("CN=doe,CN=Users,DC=example,DC=org", map[string][]string{
+		"lastLogonTimestamp": {"133170048000000000"},
+		"logonCount":         {"42"},
+	}))
+	if assert.NotNil(t, last) {
+		assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), *last)
+	}
+	assert.Equal(t, 42, count)
+
+	last, count = loginOf(ldap.NewEntry("uid=doe", map[string][]string{
+		"authTimestamp": {"20230101000000Z"},
+		attrLastLogin:   {"20230201000000Z"},
+		attrLoginCount:  {"7"},
+	}))
+	if assert.NotNil(t, last) {
+		assert.Equal(t, time.February, last.Month(), "latest")
+	}
+	assert.Equal(t, 7, count)
+
+	last, count = loginOf(ldap.NewEntry("uid=doe", nil))
+	assert.Nil(t, last)
+	assert.Zero(t, count)
+}
+
+func TestRecordLogins(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	ls := dir.newSource()
+	s := &Store{sources: []*ldapSource{ls}}
+	defer s.Close()
+
+	staff, err := s.Authenticate("doe", "secret")
+	if assert.NoError(t, err) {
+		assert.Nil(t, staff.LastLogin)
+		assert.Zero(t, staff.LogonCount)
+	}
+	assert.Empty(t, dir.callsOf("modify"), "not recorded by default")
+
+	ls.recordLogins = true
+	for i := 1; i <= 2; i++ {
+		staff, err = s.Authenticate("doe", "secret")
+		if assert.NoError(t, err) && assert.NotNil(t, staff.LastLogin) {
+			assert.Equal(t, i, staff.LogonCount)
+			assert.WithinDuration(t, time.Now(), *staff.LastLogin, time.Minute)
+		}
+	}
+	assert.Equal(t, "2", dir.attr(dn, attrLoginCount))
+	assert.NotEmpty(t, dir.attr(dn, attrLastLogin))
+
+	got, err := s.Get("doe")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, got.LogonCount)
+		assert.Equal(t, got.Version, staff.Version, "version refreshed")
+	}
+	staff.Nickname = "Doe"
+	_, err = s.Save(staff)
+	assert.NoError(t, err)
+
+	_, err = s.Authenticate("doe", "bad")
+	assert.ErrorIs(t, err, ErrLogin)
+	assert.Equal(t, "2", dir.attr(dn, attrLoginCount))
+
+	// incremented by the server, a login elsewhere is not lost
+	got, err = s.Get("doe")
+	assert.NoError(t, err)
+	dir.entries[dn][strings.ToLower(attrLoginCount)] = []string{"5"}
+	staff, err = s.Authenticate("doe", "secret")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 6, staff.LogonCount)
+	}
+	assert.Equal(t, "6", dir.attr(dn, attrLoginCount))
+
+	// a login changes the version
+	got.Nickname = "Roe"
+	_, err = s.Save(got)
+	assert.ErrorIs(t, err, ErrConflict)
+}
+
+func TestInactiveSince(t *testing.T) {
+	dir := newFakeDirectory()
+	ls := dir.newSource()
+	defer ls.Close()
+	since := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	dir.mu.Lock()
+	for uid, ts := range map[string][2]string{
+		"ann": {"20221231000000Z", "20230101080000Z"},
+		"bob": {"20230101000000Z", ""},
+		"cat": {"", "20220101000000Z"},
+		"dan": {"", ""},
+	} {
+		attrs := map[string][]string{"objectClass": objectClassPeople, "uid": {uid}, "cn": {uid}, "sn": {uid}}
+		if ts[0] != "" {
+			attrs["authTimestamp"] = []string{ts[0]}
+		}
+		if ts[1] != "" {
+			attrs[attrLastLogin] = []string{ts[1]}
+		}
+		dir.put(etPeople.DN(uid, fakeBase), attrs)
+	}
+	dir.mu.Unlock()
+
+	uids := func(data Peoples) (out []string) {
+		for _, u := range data {
+			out = append(out, u.UID)
+		}
+		sort.Strings(out)
+		return
+	}
+	spec := &Spec{InactiveSince: &since}
+	assert.Equal(t, []string{"ann", "cat", "dan"}, uids(ls.List(spec)))
+	ls.recordLogins = true
+	assert.Equal(t, []string{"bob", "cat", "dan"}, uids(ls.List(spec)))
+
+	ls.isAD = true
+	assert.Equal(t, "(!(lastLogonTimestamp>=133170048000000000))", ls.loginFilter(spec))
+}
@@ -0,0 +1,69 @@
+package ldap
+
+import (
+	"github.com/liut/staffio-backend/ldap/pool"
+	"github.com/liut/staffio-backend/metrics"
+)
+
+var _ metrics.Collector = (*Store)(nil)
+
+type poolCounter struct {
+	name, typ, help string
+	value           func(*pool.Stats) uint32
+}
+
+var poolCounters = []poolCounter{
+	{"staffio_ldap_pool_hits_total", metrics.TypeCounter, "Number of times free connection was found in the pool.",
+		func(s *pool.Stats) uint32 { return s.Hits }},
+	{"staffio_ldap_pool_misses_total", metrics.TypeCounter, "Number of times free connection was NOT found in the pool.",
+		func(s *pool.Stats) uint32 { return s.Misses }},
+	{"staffio_ldap_pool_timeouts_total", metrics.TypeCounter, "Number of times a wait timeout occurred.",
+		func(s *pool.Stats) uint32 { return s.Timeouts }},
+	{"staffio_ldap_pool_stale_conns_total", metrics.TypeCounter, "Number of stale connections removed from the pool.",
+		func(s *pool.Stats) uint32 { return s.StaleConns }},
+	{"staffio_ldap_pool_dead_conns_total", metrics.TypeCounter, "Number of connections failed the health check.",
+		func(s *pool.Stats) uint32 { return s.DeadConns }},
+	{"staffio_ldap_pool_connections", metrics.TypeGauge, "Number of connections in the pool.",
+		func(s *pool.Stats) uint32 { return s.TotalConns }},
+	{"staffio_ldap_pool_idle_connections", metrics.TypeGauge, "Number of idle connections in the pool.",
+		func(s *pool.Stats) uint32 { return s.IdleConns }},
+	{"staffio_ldap_pool_waiters", metrics.TypeGauge, "Number of callers waiting for a connection.",
+		func(s *pool.Stats) uint32 { return s.Waiters }},
+}
+
+// Collect writes stats of pools and circuit breakers of each host, labelled by addr and pool (main or auth)
+func (s *Store) Collect(w *metrics.Writer) {
+	type sourceStats struct {
+		addr, pool string
+		stats      *pool.Stats
+	}
+	var all []sourceStats
+	for _, ls := range s.sources {
+		all = append(all, sourceStats{ls.Addr, "main", ls.cp.Stats()})
+		if ls.ap != nil {
+			all = append(all, sourceStats{ls.Addr, "auth", ls.ap.Stats()})
+		}
+	}
+
+	for _, pc := range poolCounters {
+		w.Header(pc.name, pc.typ, pc.help)
+		for _, ss := range all {
+			w.Sample(pc.name, metrics.L("addr", ss.addr, "pool", ss.pool), float64(pc.value(ss.stats)))
+		}
+	}
+
+	const waitName = "staffio_ldap_pool_wait_seconds"
+	w.Header(waitName, metrics.TypeHistogram, "Time of waiting for a connection of the pool.")
+	for _, ss := range all {
+		h := ss.stats.Waits
+		w.Histogram(waitName, metrics.L("addr", ss.addr, "pool", ss.pool), h.Bounds, h.Counts, h.Sum)
+	}
+
+	const breakerName = "staffio_ldap_breaker_state"
+	w.Header(breakerName, metrics.TypeGauge, "State of circuit breaker, 0 closed, 1 open, 2 half-open.")
+	for _, ls := range s.sources {
+		if ls.cb != nil {
+			w.Sample(breakerName, metrics.L("addr", ls.Addr), float64(ls.cb.State()))
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package ldap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio-backend/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.addPeople("doe", "secret")
+	reg := metrics.NewRegistry()
+	dir.observer = reg
+	ls := dir.newSource()
+	s := &Store{sources: []*ldapSource{ls}}
+	defer s.Close()
+	reg.Register(s)
+
+	_, err := s.Get("doe")
+	assert.NoError(t, err)
+	_, err = s.Authenticate("doe", "bad")
+	assert.Error(t, err)
+	assert.NoError(t, s.PasswordReset("doe", "secret2"))
+
+	var buf bytes.Buffer
+	_, err = reg.WriteTo(&buf)
+	assert.NoError(t, err)
+	out := buf.String()
+	for _, line := range []string{
+		`staffio_ldap_operations_total{op="bind",addr="ldap://fake"} 2`,
+		`staffio_ldap_operations_total{op="passwd",addr="ldap://fake"} 1`,
+		`staffio_ldap_errors_total{op="bind",addr="ldap://fake",code="49"} 1`,
+		`staffio_ldap_pool_connections{addr="ldap://fake",pool="main"} 1`,
+		`staffio_ldap_pool_connections{addr="ldap://fake",pool="auth"} 1`,
+		`staffio_ldap_pool_misses_total{addr="ldap://fake",pool="auth"} 1`,
+		`staffio_ldap_pool_wait_seconds_count{addr="ldap://fake",pool="main"} `,
+		`staffio_ldap_breaker_state{addr="ldap://fake"} 0`,
+	} {
+		assert.Contains(t, out, line)
+	}
+	assert.Contains(t, out, `staffio_ldap_operation_duration_seconds_count{op="search",addr="ldap://fake"}`)
+}
@@ -0,0 +1,113 @@
+package ldap
+
+import (
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Observer records LDAP operations, such as *metrics.Registry
+type Observer interface {
+	Observe(op, addr string, d time.Duration, err error)
+}
+
+// names of observed operations
+const (
+	OpBind     = "bind"
+	OpSearch   = "search"
+	OpAdd      = "add"
+	OpModify   = "modify"
+	OpModifyDN = "modifydn"
+	OpDelete   = "delete"
+	OpPassword = "passwd"
+	OpCompare  = "compare"
+)
+
+// observedClient reports operations of a connection to Observer
+type observedClient struct {
+	ldap.Client
+
+	addr string
+	obs  Observer
+}
+
+func observeClient(c ldap.Client, addr string, obs Observer) ldap.Client {
+	if obs == nil {
+		return c
+	}
+	return &observedClient{Client: c, addr: addr, obs: obs}
+}
+
+func (c *observedClient) observe(op string, start time.Time, err error) {
+	c.obs.Observe(op, c.addr, time.Since(start), err)
+}
+
+func (c *observedClient) Bind(username, password string) error {
+	start := time.Now()
+	err := c.Client.Bind(username, password)
+	c.observe(OpBind, start, err)
+	return err
+}
+
+func (c *observedClient) SimpleBind(req *ldap.SimpleBindRequest) (*ldap.SimpleBindResult, error) {
+	start := time.Now()
+	r, err := c.Client.SimpleBind(req)
+	c.observe(OpBind, start, err)
+	return r, err
+}
+
+func (c *observedClient) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	start := time.Now()
+	sr, err := c.Client.Search(req)
+	c.observe(OpSearch, start, err)
+	return sr, err
+}
+
+func (c *observedClient) SearchWithPaging(req *ldap.SearchRequest, pagingSize uint32) (*ldap.SearchResult, error) {
+	start := time.Now()
+	sr, err := c.Client.SearchWithPaging(req, pagingSize)
+	c.observe(OpSearch, start, err)
+	return sr, err
+}
+
+func (c *observedClient) Add(req *ldap.AddRequest) error {
+	start := time.Now()
+	err := c.Client.Add(req)
+	c.observe(OpAdd, start, err)
+	return err
+}
+
+func (c *observedClient) Modify(req *ldap.ModifyRequest) error {
+	start := time.Now()
+	err := c.Client.Modify(req)
+	c.observe(OpModify, start, err)
+	return err
+}
+
+func (c *observedClient) ModifyDN(req *ldap.ModifyDNRequest) error {
+	start := time.Now()
+	err := c.Client.ModifyDN(req)
+	c.observe(OpModifyDN, start, err)
+	return err
+}
+
+func (c *observedClient) Del(req *ldap.DelRequest) error {
+	start := time.Now()
+	err := c.Client.Del(req)
+	c.observe(OpDelete, start, err)
+	return err
+}
+
+func (c *observedClient) PasswordModify(req *ldap.PasswordModifyRequest) (*ldap.PasswordModifyResult, error) {
+	start := time.Now()
+	r, err := c.Client.PasswordModify(req)
+	c.observe(OpPassword, start, err)
+	return r, err
+}
+
+func (c *observedClient) Compare(dn, attribute, value string) (bool, error) {
+	start := time.Now()
+	ok, err := c.Client.Compare(dn, attribute, value)
+	c.observe(OpCompare, start, err)
+	return ok, err
+}
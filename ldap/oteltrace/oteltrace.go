@@ -0,0 +1,73 @@
+// Package oteltrace adapts a TracerProvider of OpenTelemetry to ldap.Tracer
+package oteltrace
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/liut/staffio-backend/ldap"
+)
+
+// InstrumentationName name of tracer
+const InstrumentationName = "github.com/liut/staffio-backend/ldap"
+
+type tracer struct {
+	tr trace.Tracer
+}
+
+var _ ldap.Tracer = (*tracer)(nil)
+
+// New returns a ldap.Tracer with tp, the global TracerProvider if nil
+func New(tp trace.TracerProvider) ldap.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &tracer{tr: tp.Tracer(InstrumentationName)}
+}
+
+func (t *tracer) Start(ctx context.Context, name string, attrs ...ldap.Attr) (context.Context, ldap.Span) {
+	ctx, s := t.tr.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(convert(attrs)...))
+	return ctx, &span{s}
+}
+
+type span struct {
+	s trace.Span
+}
+
+func (s *span) SetAttributes(attrs ...ldap.Attr) {
+	s.s.SetAttributes(convert(attrs)...)
+}
+
+func (s *span) End(err error) {
+	if err != nil {
+		s.s.RecordError(err)
+		s.s.SetStatus(codes.Error, err.Error())
+	}
+	s.s.End()
+}
+
+func convert(attrs []ldap.Attr) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(a.Key, v))
+		case int:
+			kvs = append(kvs, attribute.Int(a.Key, v))
+		case int64:
+			kvs = append(kvs, attribute.Int64(a.Key, v))
+		case bool:
+			kvs = append(kvs, attribute.Bool(a.Key, v))
+		default:
+			kvs = append(kvs, attribute.String(a.Key, fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,56 @@
+package oteltrace
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/liut/staffio-backend/ldap"
+)
+
+func TestTracer(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	tr := New(tp)
+
+	ctx, root := tp.Tracer("test").Start(context.Background(), "login")
+	ctx, op := tr.Start(ctx, ldap.SpanOp, ldap.Attr{Key: ldap.AttrAddr, Value: "ldap://a"})
+	_, bind := tr.Start(ctx, ldap.SpanBind)
+	bind.SetAttributes(ldap.Attr{Key: ldap.AttrResultCode, Value: 49}, ldap.Attr{Key: "ok", Value: false},
+		ldap.Attr{Key: "n", Value: int64(2)}, ldap.Attr{Key: "other", Value: 1.5})
+	bind.End(errors.New("invalid credentials"))
+	op.End(nil)
+	root.End()
+
+	spans := rec.Ended()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	b, o := spans[0], spans[1]
+	assert.Equal(t, ldap.SpanBind, b.Name())
+	assert.Equal(t, o.SpanContext().SpanID(), b.Parent().SpanID())
+	assert.Equal(t, root.SpanContext().SpanID(), o.Parent().SpanID())
+	assert.Equal(t, trace.SpanKindClient, o.SpanKind())
+	assert.Equal(t, InstrumentationName, o.InstrumentationScope().Name)
+
+	assert.Equal(t, codes.Error, b.Status().Code)
+	assert.Len(t, b.Events(), 1, "error recorded")
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		attribute.Int(ldap.AttrResultCode, 49),
+		attribute.Bool("ok", false),
+		attribute.Int64("n", 2),
+		attribute.String("other", "1.5"),
+	}, b.Attributes())
+
+	assert.Equal(t, codes.Unset, o.Status().Code)
+	assert.Equal(t, []attribute.KeyValue{attribute.String(ldap.AttrAddr, "ldap://a")}, o.Attributes())
+
+	assert.NotNil(t, New(nil))
+}
@@ -0,0 +1,126 @@
+package ldap
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/liut/staffio-backend/audit"
+	"github.com/liut/staffio-backend/model"
+)
+
+// PeoplePatch ...
+type PeoplePatch = model.PeoplePatch
+
+// attrOfField attribute names by JSON names of fields of PeoplePatch
+var attrOfField = map[string]string{
+	"cn":          "cn",
+	"gn":          "givenName",
+	"sn":          "sn",
+	"nickname":    "displayName",
+	"birthday":    "dateOfBirth",
+	"gender":      "gender",
+	"email":       "mail",
+	"mobile":      "mobile",
+	"eid":         "employeeNumber",
+	"etype":       "employeeType",
+	"avatarPath":  "avatarPath",
+	"description": "description",
+	"joinDate":    "dateOfJoin",
+	"idcn":        "idcnNumber",
+}
+
+// Patch changes only the fields set in patch of People of uid with the service account, an empty value clears the field
+func (s *Store) Patch(uid string, patch *PeoplePatch) (err error) {
+	before := s.auditGet(uid)
+	defer func() {
+		var after *People
+		if before != nil {
+			p := *before
+			patch.Apply(&p)
+			after = &p
+		}
+		s.emitPeople(audit.ActionPatch, uid, before, after, err)
+	}()
+	sources, err := s.writable(OpModify)
+	if err != nil {
+		return
+	}
+	for _, ls := range sources {
+		err = ls.patchPeople(uid, patch, s.validate)
+		if err != nil {
+			logger().Infow("patch fail", "uid", uid, "fields", patch.Fields(), "err", err)
+			err = ls.opError(OpModify, ls.UDN(uid), err)
+			return
+		}
+	}
+	return
+}
+
+// patchPeople changes fields in patch of People of uid, check validates the fields of People as patched
+// before any change is sent
+func (ls *ldapSource) patchPeople(uid string, patch *PeoplePatch, check func(*People, ...string) error) error {
+	if uid == "" {
+		return ErrEmptyUID
+	}
+	userdn := ls.UDN(uid)
+	useAssert := patch.Version != "" && ls.useAssertion()
+	ls, span := ls.trace(SpanModify, Attr{AttrBase, userdn})
+	err := ls.opWithMan(func(c ldap.Client) (err error) {
+		entry, err := ldapFindOne(c, userdn, etPeople.Filter, etPeople.Attributes...)
+		if err != nil {
+			return err
+		}
+		if check != nil {
+			after := ls.toPeople(entry)
+			patch.Apply(after)
+			if err = check(after, patch.Fields()...); err != nil {
+				return err
+			}
+		}
+		mr := makePatchRequest(entry, patch)
+		if mr.Controls, err = expectVersion(entry, patch.Version, useAssert); err != nil {
+			return err
+		}
+		err = ls.sealModify(mr, entry, func(name string) *string {
+			if v, ok := patch.Get(fieldOfAttr[strings.ToLower(name)]); ok {
+				return &v
+			}
+			return nil
+		})
+		if err != nil || len(mr.Changes) == 0 {
+			return err
+		}
+		mr.Replace("modifiedTime", []string{FormatGeneralizedTime(time.Now())})
+		if err = versionError(c.Modify(mr)); err != nil {
+			logger().Infow("modify fail", "dn", userdn, "err", err)
+		}
+		return err
+	})
+	endSpan(span, err)
+	return err
+}
+
+// makePatchRequest returns a minimal request of changed attributes, nothing for a value unchanged or an absent cleared
+func makePatchRequest(entry *ldap.Entry, patch *PeoplePatch) *ldap.ModifyRequest {
+	mr := ldap.NewModifyRequest(entry.DN, nil)
+	for _, field := range patch.Fields() {
+		attr := attrOfField[field]
+		value, _ := patch.Get(field)
+		switch field {
+		case "gender":
+			value = model.Initial(value)
+		case "birthday", "joinDate":
+			value = model.Date(value).LDAP()
+		}
+		cur := entry.GetAttributeValues(attr)
+		switch {
+		case value == "" && len(cur) > 0:
+			mr.Replace(attr, nil)
+		case value != "" && (len(cur) != 1 || cur[0] != value):
+			mr.Replace(attr, []string{value})
+		}
+	}
+	return mr
+}
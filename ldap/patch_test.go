@@ -0,0 +1,128 @@
+package ldap
+
+import (
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio-backend/model"
+)
+
+func TestPatch(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	dir.entries[dn]["description"] = []string{"old"}
+	dir.entries[dn]["gender"] = []string{"M"}
+	s := &Store{sources: []*ldapSource{dir.newSource()}}
+	defer s.Close()
+
+	p, err := model.DecodeMergePatch([]byte(`{"nickname":"Doe","description":null,"gender":"F","mobile":null}`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, s.Patch("doe", p))
+	if calls := dir.callsOf("modify"); assert.Len(t, calls, 1) {
+		assert.Equal(t, fakeAdminDN, calls[0].by)
+	}
+	assert.Equal(t, "Doe", dir.attr(dn, "displayName"))
+	assert.Empty(t, dir.attr(dn, "description"))
+	assert.Equal(t, "F", dir.attr(dn, "gender"))
+	assert.Equal(t, "doe", dir.attr(dn, "sn"), "unchanged")
+
+	// minimal request
+	var entry *ldap.Entry
+	assert.NoError(t, s.sources[0].opWithMan(func(c ldap.Client) (err error) {
+		entry, err = ldapFindOne(c, dn, etPeople.Filter, etPeople.Attributes...)
+		return
+	}))
+	assert.Empty(t, makePatchRequest(entry, p).Changes)
+
+	// nothing to change, no request
+	assert.NoError(t, s.Patch("doe", p))
+	assert.Len(t, dir.callsOf("modify"), 1)
+
+	assert.Error(t, s.Patch("nobody", p))
+}
+
+func TestPatchInvalid(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	s := &Store{sources: []*ldapSource{dir.newSource()}}
+	defer s.Close()
+
+	for field, body := range map[string]string{
+		"email":    `{"email":"doe"}`,
+		"birthday": `{"birthday":"1990-13-01"}`,
+		"gender":   `{"gender":"Male"}`,
+		"idcn":     `{"idcn":"110101199001011234"}`,
+		"sn":       `{"sn":null}`,
+	} {
+		p, err := model.DecodeMergePatch([]byte(body))
+		if !assert.NoError(t, err) {
+			continue
+		}
+		err = s.Patch("doe", p)
+		assert.ErrorIs(t, err, model.ErrInvalidPeople, field)
+		var ve *model.ValidationError
+		if assert.ErrorAs(t, err, &ve, field) {
+			assert.True(t, ve.Has(field), field)
+		}
+	}
+	assert.Empty(t, dir.callsOf("modify"), "rejected before sent")
+	assert.Equal(t, "doe", dir.attr(dn, "sn"))
+}
+
+func TestPatchLegacyValues(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	dir.entries[dn]["mobile"] = []string{"12345"}
+	dir.entries[dn]["idcnnumber"] = []string{"110105491231002"}
+	s := &Store{sources: []*ldapSource{dir.newSource()}}
+	defer s.Close()
+
+	// an old value failing the rules does not block changes of other fields
+	p := new(PeoplePatch)
+	_ = p.Set("nickname", "Doe")
+	assert.NoError(t, s.Patch("doe", p))
+	assert.Equal(t, "Doe", dir.attr(dn, "displayName"))
+
+	staff, err := s.Get("doe")
+	if assert.NoError(t, err) {
+		staff.Description = "boss"
+		assert.NoError(t, s.ModifyAs(RoleAdmin, "doe", staff))
+		assert.Equal(t, "boss", dir.attr(dn, "description"))
+	}
+
+	// but a change of it is checked
+	p = new(PeoplePatch)
+	_ = p.Set("mobile", "54321")
+	assert.ErrorIs(t, s.Patch("doe", p), model.ErrInvalidPeople)
+	assert.Equal(t, "12345", dir.attr(dn, "mobile"))
+}
+
+func TestPatchSealed(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	s := &Store{sources: []*ldapSource{dir.newSource()}}
+	defer s.Close()
+	ls := s.sources[0]
+	ls.sealer = newFakeSealer(t, "k1")
+	ls.sealed = DefaultSealedAttributes
+
+	p := new(PeoplePatch)
+	_ = p.Set("idcn", "110101199001011237")
+	assert.NoError(t, s.Patch("doe", p))
+	assert.Empty(t, dir.attr(dn, "idcnNumber"))
+	assert.NotEmpty(t, dir.attr(dn, attrSealed))
+	staff, err := s.Get("doe")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "110101199001011237", staff.IDCN)
+	}
+
+	p = new(PeoplePatch)
+	_ = p.Clear("idcn")
+	assert.NoError(t, s.Patch("doe", p))
+	assert.Empty(t, dir.attr(dn, attrSealed))
+	assert.Empty(t, dir.attr(dn, attrBlindIndex))
+}
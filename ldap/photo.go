@@ -0,0 +1,112 @@
+package ldap
+
+import (
+	"strconv"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/liut/staffio-backend/audit"
+	"github.com/liut/staffio-backend/photo"
+)
+
+const attrPhoto = "jpegPhoto"
+
+// SetPhoto checks and stores the photo of uid, re-encoded as JPEG within PhotoMaxSize,
+// the error matches photo.ErrFormat or photo.ErrTooLarge if rejected
+func (s *Store) SetPhoto(uid string, data []byte) (err error) {
+	defer func() { s.emit(audit.ActionSetPhoto, uid, photoChanges(data), err) }()
+	if data, err = photo.ToJPEG(data, s.photoMax); err != nil {
+		logger().Infow("photo rejected", "uid", uid, "err", err)
+		return
+	}
+	sources, err := s.writable(OpModify)
+	if err != nil {
+		return
+	}
+	for _, ls := range sources {
+		if err = ls.setPhoto(uid, data); err != nil {
+			err = ls.opError(OpModify, ls.UDN(uid), err)
+			return
+		}
+	}
+	return
+}
+
+// GetPhoto returns the JPEG photo of uid, nil if none
+func (s *Store) GetPhoto(uid string) (data []byte, err error) {
+	var errs []error
+	for _, ls := range s.available() {
+		data, err = ls.getPhoto(uid)
+		if err == nil {
+			return
+		}
+		errs = append(errs, ls.opError(OpSearch, ls.UDN(uid), err))
+	}
+	if err = multiError(errs); err == nil {
+		err = ErrNotFound
+	}
+	return
+}
+
+// DeletePhoto removes the photo of uid
+func (s *Store) DeletePhoto(uid string) (err error) {
+	defer func() { s.emit(audit.ActionDeletePhoto, uid, photoChanges(nil), err) }()
+	sources, err := s.writable(OpModify)
+	if err != nil {
+		return
+	}
+	for _, ls := range sources {
+		if err = ls.setPhoto(uid, nil); err != nil {
+			err = ls.opError(OpModify, ls.UDN(uid), err)
+			return
+		}
+	}
+	return
+}
+
+// setPhoto replaces jpegPhoto, removes it if data is empty
+func (ls *ldapSource) setPhoto(uid string, data []byte) error {
+	dn := ls.UDN(uid)
+	return ls.opWithMan(func(c ldap.Client) error {
+		mr := ldap.NewModifyRequest(dn, nil)
+		if len(data) > 0 {
+			mr.Replace(attrPhoto, []string{string(data)})
+		} else {
+			mr.Replace(attrPhoto, nil)
+		}
+		err := c.Modify(mr)
+		if err != nil {
+			logger().Infow("set photo fail", "dn", dn, "err", err)
+		}
+		return err
+	})
+}
+
+func (ls *ldapSource) getPhoto(uid string) ([]byte, error) {
+	entry, err := ls.getEntry(ls.UDN(uid), ls.etUser().Filter, attrPhoto)
+	if err != nil {
+		return nil, err
+	}
+	if data := entry.GetRawAttributeValue(attrPhoto); len(data) > 0 {
+		return data, nil
+	}
+	return nil, nil
+}
+
+func photoChanges(data []byte) []audit.Change {
+	change := audit.Change{Field: attrPhoto}
+	if len(data) > 0 {
+		change.New = strconv.Itoa(len(data)) + " bytes"
+	}
+	return []audit.Change{change}
+}
+
+func withoutAttr(attrs []string, name string) []string {
+	out := make([]string, 0, len(attrs))
+	for _, a := range attrs {
+		if a != name {
+			out = append(out, a)
+		}
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+package ldap
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio-backend/audit"
+	"github.com/liut/staffio-backend/photo"
+)
+
+func TestPhoto(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	sink := new(audit.MemorySink)
+	s := &Store{sources: []*ldapSource{dir.newSource()}, audit: sink, photoMax: 4 << 10}
+	defer s.Close()
+
+	data, err := s.GetPhoto("doe")
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+	_, err = s.GetPhoto("nobody")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)))
+	assert.NoError(t, s.SetPhoto("doe", buf.Bytes()))
+	data, err = s.GetPhoto("doe")
+	if assert.NoError(t, err) {
+		assert.Equal(t, photo.MIMEJPEG, photo.Detect(data), "converted")
+		assert.Equal(t, string(data), dir.attr(dn, attrPhoto))
+	}
+	staff, err := s.Get("doe")
+	if assert.NoError(t, err) {
+		assert.Equal(t, data, staff.JpegPhoto)
+	}
+
+	assert.ErrorIs(t, s.SetPhoto("doe", []byte("GIF89a")), photo.ErrFormat)
+	big := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	_, _ = rand.New(rand.NewSource(1)).Read(big.Pix)
+	buf.Reset()
+	_ = png.Encode(&buf, big)
+	assert.ErrorIs(t, s.SetPhoto("doe", buf.Bytes()), photo.ErrTooLarge)
+
+	data2, _ := s.GetPhoto("doe")
+	assert.Equal(t, data, data2, "unchanged")
+
+	assert.NoError(t, s.DeletePhoto("doe"))
+	data, err = s.GetPhoto("doe")
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+
+	events := sink.Events()
+	if assert.Len(t, events, 4) {
+		assert.Equal(t, audit.ActionSetPhoto, events[0].Action)
+		assert.Equal(t, audit.OutcomeFailure, events[1].Outcome)
+		assert.Equal(t, audit.ActionDeletePhoto, events[3].Action)
+	}
+}
+
+func TestListSkipPhoto(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	dir.mu.Lock()
+	dir.get(dn)["jpegphoto"] = []string{"\xff\xd8\xff"}
+	dir.mu.Unlock()
+	ls := dir.newSource()
+	defer ls.Close()
+
+	data := ls.List(&Spec{})
+	if assert.Len(t, data, 1) {
+		assert.NotEmpty(t, data[0].JpegPhoto)
+	}
+	data = ls.List(&Spec{SkipPhoto: true})
+	if assert.Len(t, data, 1) {
+		assert.Empty(t, data[0].JpegPhoto)
+	}
+}
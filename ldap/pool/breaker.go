@@ -0,0 +1,214 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen dial refused because the breaker of host is open
+var ErrBreakerOpen = errors.New("circuit breaker is open")
+
+// BreakerState ...
+type BreakerState int32
+
+// states of breaker
+const (
+	StateClosed   BreakerState = iota // dial normally
+	StateOpen                         // refuse to dial until the backoff delay passed
+	StateHalfOpen                     // one trial dial in flight
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int32(s))
+}
+
+// MarshalText ...
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// BreakerOptions ...
+type BreakerOptions struct {
+	// Threshold consecutive failures to open the breaker, default 5
+	Threshold int
+	// BaseDelay first delay of open, doubled on each failed trial, default 1s
+	BaseDelay time.Duration
+	// MaxDelay limit of delay, default 1m
+	MaxDelay time.Duration
+	// OnStateChange is called after the state changed, optional
+	OnStateChange func(name string, from, to BreakerState)
+
+	Now func() time.Time
+}
+
+// BreakerStatus ...
+type BreakerStatus struct {
+	State     BreakerState `json:"state"`
+	Failures  int          `json:"failures"`            // consecutive failures
+	LastError string       `json:"lastError,omitempty"` // last failure
+	RetryAt   time.Time    `json:"retryAt"`             // when the open breaker allows a trial, zero if not open
+}
+
+// Breaker a circuit breaker of one host with exponential backoff and jitter
+type Breaker struct {
+	name string
+	opt  BreakerOptions
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int // consecutive failures
+	trials   int // consecutive failed trials, for backoff
+	retryAt  time.Time
+	lastErr  error
+}
+
+// NewBreaker ...
+func NewBreaker(name string, opt *BreakerOptions) *Breaker {
+	b := &Breaker{name: name}
+	if opt != nil {
+		b.opt = *opt
+	}
+	if b.opt.Threshold <= 0 {
+		b.opt.Threshold = 5
+	}
+	if b.opt.BaseDelay <= 0 {
+		b.opt.BaseDelay = time.Second
+	}
+	if b.opt.MaxDelay <= 0 {
+		b.opt.MaxDelay = time.Minute
+	}
+	if b.opt.MaxDelay < b.opt.BaseDelay {
+		b.opt.MaxDelay = b.opt.BaseDelay
+	}
+	if b.opt.Now == nil {
+		b.opt.Now = time.Now
+	}
+	return b
+}
+
+// Name ...
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// Allow returns nil if a dial is allowed, an open breaker turns half-open after the delay and allows one trial
+func (b *Breaker) Allow() error {
+	return b.change(func() error {
+		switch b.state {
+		case StateClosed:
+			return nil
+		case StateOpen:
+			if !b.opt.Now().Before(b.retryAt) {
+				b.state = StateHalfOpen
+				return nil
+			}
+		}
+		return b.openError()
+	})
+}
+
+// Ready reports whether a dial may be allowed, without changing the state
+func (b *Breaker) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == StateClosed || (b.state == StateOpen && !b.opt.Now().Before(b.retryAt))
+}
+
+// Success closes the breaker
+func (b *Breaker) Success() {
+	_ = b.change(func() error {
+		b.failures = 0
+		b.trials = 0
+		b.lastErr = nil
+		b.state = StateClosed
+		return nil
+	})
+}
+
+// Failure records a failed dial, opens the breaker after Threshold failures or a failed trial
+func (b *Breaker) Failure(err error) {
+	_ = b.change(func() error {
+		b.failures++
+		b.lastErr = err
+		switch b.state {
+		case StateClosed:
+			if b.failures >= b.opt.Threshold {
+				b.open()
+			}
+		case StateHalfOpen:
+			b.trials++
+			b.open()
+		}
+		return nil
+	})
+}
+
+// State ...
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Status ...
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := BreakerStatus{State: b.state, Failures: b.failures}
+	if b.lastErr != nil {
+		st.LastError = b.lastErr.Error()
+	}
+	if b.state == StateOpen {
+		st.RetryAt = b.retryAt
+	}
+	return st
+}
+
+func (b *Breaker) open() {
+	b.retryAt = b.opt.Now().Add(b.delay())
+	b.state = StateOpen
+}
+
+// delay BaseDelay * 2^trials within MaxDelay, half of it is random
+func (b *Breaker) delay() time.Duration {
+	d := b.opt.BaseDelay
+	for i := 0; i < b.trials && d < b.opt.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > b.opt.MaxDelay {
+		d = b.opt.MaxDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)) // nolint
+}
+
+// change runs fn locked, and calls OnStateChange after unlocked
+func (b *Breaker) change(fn func() error) error {
+	b.mu.Lock()
+	from := b.state
+	err := fn()
+	to := b.state
+	b.mu.Unlock()
+	if b.opt.OnStateChange != nil && from != to {
+		b.opt.OnStateChange(b.name, from, to)
+	}
+	return err
+}
+
+func (b *Breaker) openError() error {
+	if b.lastErr != nil {
+		return fmt.Errorf("%w (%s): %w", ErrBreakerOpen, b.name, b.lastErr)
+	}
+	return fmt.Errorf("%w (%s)", ErrBreakerOpen, b.name)
+}
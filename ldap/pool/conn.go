@@ -14,6 +14,8 @@ type Conn struct {
 	pooled    bool
 	createdAt time.Time
 	usedAt    atomic.Value
+	checked   int64  // atomic, unix nano of the last health check
+	boundDN   string // identity of the last successful bind, empty if anonymous
 }
 
 // NewConn ...
@@ -36,6 +38,29 @@ func (cn *Conn) SetUsedAt(tm time.Time) {
 	cn.usedAt.Store(tm)
 }
 
+// checkedAt returns the time of the last health check or use, which is later
+func (cn *Conn) checkedAt() time.Time {
+	t := time.Unix(0, atomic.LoadInt64(&cn.checked))
+	if u := cn.UsedAt(); u.After(t) {
+		return u
+	}
+	return t
+}
+
+func (cn *Conn) setCheckedAt(tm time.Time) {
+	atomic.StoreInt64(&cn.checked, tm.UnixNano())
+}
+
+// BoundDN returns the identity of the last successful bind
+func (cn *Conn) BoundDN() string {
+	return cn.boundDN
+}
+
+// SetBoundDN records the identity after a bind, empty for anonymous or unknown
+func (cn *Conn) SetBoundDN(dn string) {
+	cn.boundDN = dn
+}
+
 // // Close ...
 // func (cn *Conn) Close() error {
 // 	cn.Client.Close()
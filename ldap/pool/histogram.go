@@ -0,0 +1,75 @@
+package pool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// waitBounds upper bounds of buckets of wait time
+var waitBounds = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Histogram of durations, Counts[i] is number of durations in (Bounds[i-1], Bounds[i]],
+// the last of Counts is number of durations over all Bounds
+type Histogram struct {
+	Bounds []time.Duration `json:"bounds"`
+	Counts []uint64        `json:"counts"`
+	Count  uint64          `json:"count"`
+	Sum    time.Duration   `json:"sum"`
+}
+
+// Add merges o with the same bounds into h
+func (h *Histogram) Add(o Histogram) {
+	if len(h.Counts) == 0 {
+		h.Bounds = o.Bounds
+		h.Counts = make([]uint64, len(o.Counts))
+	}
+	for i := 0; i < len(h.Counts) && i < len(o.Counts); i++ {
+		h.Counts[i] += o.Counts[i]
+	}
+	h.Count += o.Count
+	h.Sum += o.Sum
+}
+
+// histogram collects durations atomically
+type histogram struct {
+	bounds []time.Duration
+	counts []uint64
+	count  uint64
+	sum    int64
+}
+
+func newHistogram(bounds []time.Duration) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(h.bounds) && d > h.bounds[i] {
+		i++
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	s := Histogram{
+		Bounds: h.bounds,
+		Counts: make([]uint64, len(h.counts)),
+		Count:  atomic.LoadUint64(&h.count),
+		Sum:    time.Duration(atomic.LoadInt64(&h.sum)),
+	}
+	for i := range h.counts {
+		s.Counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	return s
+}
@@ -1,6 +1,7 @@
 package pool
 
 import (
+	"context"
 	"errors"
 	"log"
 	"sync"
@@ -33,13 +34,20 @@ type Stats struct {
 	TotalConns uint32 `json:"totalConns"` // number of total connections in the pool
 	IdleConns  uint32 `json:"idelConns"`  // number of idle connections in the pool
 	StaleConns uint32 `json:"staleConns"` // number of stale connections removed from the pool
+	DeadConns  uint32 `json:"deadConns"`  // number of connections failed the health check
+
+	Waiters uint32    `json:"waiters"` // number of callers waiting for a connection
+	Waits   Histogram `json:"waits"`   // time of waiting for a turn of the pool
 }
 
 // Pooler ...
 type Pooler interface {
 	Get() (*Conn, error)
+	GetContext(ctx context.Context) (*Conn, error)
+	GetNew() (*Conn, error)
+	GetNewContext(ctx context.Context) (*Conn, error)
 	Put(c *Conn)
-	// Remove(c *Conn)
+	Remove(c *Conn)
 
 	Len() int
 	IdleLen() int
@@ -56,21 +64,29 @@ type Options struct {
 	PoolSize           int
 	MinIdleConns       int
 	MaxConnAge         time.Duration
-	PoolTimeout        time.Duration
+	PoolTimeout        time.Duration // max wait for a connection, zero to wait until ctx done
 	IdleTimeout        time.Duration
 	IdleCheckFrequency time.Duration
+
+	// Breaker of the host, may be shared by pools of the same host, default a new one
+	Breaker *Breaker
+
+	// HealthCheck probes a connection, such as a read of root DSE, nil to disable
+	HealthCheck func(*Conn) error
+	// HealthCheckIdle checks a connection before handed out if unchecked for this duration, zero to always
+	HealthCheckIdle time.Duration
+	// KeepAliveInterval probes idle connections in background, zero to disable
+	KeepAliveInterval time.Duration
 }
 
 // ConnPool ...
 type ConnPool struct {
 	opt *Options
 
-	dialErrorsNum uint32 // atomic
-
-	lastDialErrorMu sync.RWMutex
-	lastDialError   error
+	breaker *Breaker
 
-	queue chan struct{}
+	turns *turns
+	waits *histogram
 
 	connsMu      sync.Mutex
 	conns        []*Conn
@@ -88,13 +104,19 @@ var _ Pooler = (*ConnPool)(nil)
 // NewPool ...
 func NewPool(opt *Options) *ConnPool {
 	p := &ConnPool{
-		opt: opt,
+		opt:     opt,
+		breaker: opt.Breaker,
 
-		queue:     make(chan struct{}, opt.PoolSize),
+		turns:     newTurns(opt.PoolSize),
+		waits:     newHistogram(waitBounds),
 		conns:     make([]*Conn, 0, opt.PoolSize),
 		idleConns: make([]*Conn, 0, opt.PoolSize),
 	}
 
+	if p.breaker == nil {
+		p.breaker = NewBreaker("", nil)
+	}
+
 	for i := 0; i < opt.MinIdleConns; i++ {
 		p.checkMinIdleConns()
 	}
@@ -103,6 +125,10 @@ func NewPool(opt *Options) *ConnPool {
 		go p.reaper(opt.IdleCheckFrequency)
 	}
 
+	if opt.HealthCheck != nil && opt.KeepAliveInterval > 0 {
+		go p.keepAlive(opt.KeepAliveInterval)
+	}
+
 	return p
 }
 
@@ -153,63 +179,39 @@ func (p *ConnPool) newConn(pooled bool) (*Conn, error) {
 		return nil, ErrClosed
 	}
 
-	if atomic.LoadUint32(&p.dialErrorsNum) >= uint32(p.opt.PoolSize) {
-		return nil, p.getLastDialError()
+	if err := p.breaker.Allow(); err != nil {
+		return nil, err
 	}
 
 	netConn, err := p.opt.Factory()
 	if err != nil {
-		p.setLastDialError(err)
-		if atomic.AddUint32(&p.dialErrorsNum, 1) == uint32(p.opt.PoolSize) {
-			go p.tryDial()
-		}
+		p.breaker.Failure(err)
 		return nil, err
 	}
+	p.breaker.Success()
 
 	cn := NewConn(netConn)
 	cn.pooled = pooled
 	return cn, nil
 }
 
-func (p *ConnPool) tryDial() {
-	for {
-		if p.closed() {
-			return
-		}
-
-		conn, err := p.opt.Factory()
-		if err != nil {
-			p.setLastDialError(err)
-			time.Sleep(time.Second)
-			continue
-		}
-
-		atomic.StoreUint32(&p.dialErrorsNum, 0)
-		conn.Close()
-		return
-	}
-}
-
-func (p *ConnPool) setLastDialError(err error) {
-	p.lastDialErrorMu.Lock()
-	p.lastDialError = err
-	p.lastDialErrorMu.Unlock()
-}
-
-func (p *ConnPool) getLastDialError() error {
-	p.lastDialErrorMu.RLock()
-	err := p.lastDialError
-	p.lastDialErrorMu.RUnlock()
-	return err
+// Breaker returns the circuit breaker of dial
+func (p *ConnPool) Breaker() *Breaker {
+	return p.breaker
 }
 
 // Get returns existed connection from the pool or creates a new one.
 func (p *ConnPool) Get() (*Conn, error) {
+	return p.GetContext(context.Background())
+}
+
+// GetContext like Get, waits first-in first-out until ctx is done or PoolTimeout.
+func (p *ConnPool) GetContext(ctx context.Context) (*Conn, error) {
 	if p.closed() {
 		return nil, ErrClosed
 	}
 
-	err := p.waitTurn()
+	err := p.waitTurn(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -224,7 +226,14 @@ func (p *ConnPool) Get() (*Conn, error) {
 		}
 
 		if p.isStaleConn(cn) {
-			cn.Close()
+			p.CloseConn(cn)
+			atomic.AddUint32(&p.stats.StaleConns, 1)
+			continue
+		}
+
+		if p.isDeadConn(cn) {
+			p.CloseConn(cn)
+			atomic.AddUint32(&p.stats.DeadConns, 1)
 			continue
 		}
 
@@ -243,35 +252,48 @@ func (p *ConnPool) Get() (*Conn, error) {
 	return newcn, nil
 }
 
+// GetNew like Get, but always creates a new connection, such as a retry after a network error.
+func (p *ConnPool) GetNew() (*Conn, error) {
+	return p.GetNewContext(context.Background())
+}
+
+// GetNewContext like GetNew, waits until ctx is done or PoolTimeout.
+func (p *ConnPool) GetNewContext(ctx context.Context) (*Conn, error) {
+	if p.closed() {
+		return nil, ErrClosed
+	}
+
+	if err := p.waitTurn(ctx); err != nil {
+		return nil, err
+	}
+
+	atomic.AddUint32(&p.stats.Misses, 1)
+
+	cn, err := p._NewConn(true)
+	if err != nil {
+		p.freeTurn()
+		return nil, err
+	}
+
+	return cn, nil
+}
+
 func (p *ConnPool) getTurn() {
-	p.queue <- struct{}{}
+	_ = p.turns.acquire(context.Background(), 0)
 }
 
-func (p *ConnPool) waitTurn() error {
-	select {
-	case p.queue <- struct{}{}:
-		return nil
-	default:
-		timer := timers.Get().(*time.Timer)
-		timer.Reset(p.opt.PoolTimeout)
-
-		select {
-		case p.queue <- struct{}{}:
-			if !timer.Stop() {
-				<-timer.C
-			}
-			timers.Put(timer)
-			return nil
-		case <-timer.C:
-			timers.Put(timer)
-			atomic.AddUint32(&p.stats.Timeouts, 1)
-			return ErrPoolTimeout
-		}
+func (p *ConnPool) waitTurn(ctx context.Context) error {
+	start := time.Now()
+	err := p.turns.acquire(ctx, p.opt.PoolTimeout)
+	p.waits.observe(time.Since(start))
+	if err == ErrPoolTimeout {
+		atomic.AddUint32(&p.stats.Timeouts, 1)
 	}
+	return err
 }
 
 func (p *ConnPool) freeTurn() {
-	<-p.queue
+	p.turns.release()
 }
 
 func (p *ConnPool) popIdle() *Conn {
@@ -294,6 +316,11 @@ func (p *ConnPool) Put(cn *Conn) {
 		return
 	}
 
+	cn.SetUsedAt(time.Now())
+	p.putIdle(cn)
+}
+
+func (p *ConnPool) putIdle(cn *Conn) {
 	p.connsMu.Lock()
 	p.idleConns = append(p.idleConns, cn)
 	p.idleConnsLen++
@@ -363,6 +390,10 @@ func (p *ConnPool) Stats() *Stats {
 		TotalConns: uint32(p.Len()),
 		IdleConns:  uint32(idleLen),
 		StaleConns: atomic.LoadUint32(&p.stats.StaleConns),
+		DeadConns:  atomic.LoadUint32(&p.stats.DeadConns),
+
+		Waiters: uint32(p.turns.waiting()),
+		Waits:   p.waits.snapshot(),
 	}
 }
 
@@ -404,15 +435,15 @@ func (p *ConnPool) reapStaleConn() *Conn {
 		return nil
 	}
 
-	cn := p.idleConns[0]
-	if !p.isStaleConn(cn) {
-		return nil
+	for i, cn := range p.idleConns {
+		if p.isStaleConn(cn) {
+			p.idleConns = append(p.idleConns[:i], p.idleConns[i+1:]...)
+			p.idleConnsLen--
+			return cn
+		}
 	}
 
-	p.idleConns = append(p.idleConns[:0], p.idleConns[1:]...)
-	p.idleConnsLen--
-
-	return cn
+	return nil
 }
 
 func (p *ConnPool) reapStaleConns() (int, error) {
@@ -472,3 +503,69 @@ func (p *ConnPool) isStaleConn(cn *Conn) bool {
 
 	return false
 }
+
+// isDeadConn reports whether the connection is closing or fails the health check
+func (p *ConnPool) isDeadConn(cn *Conn) bool {
+	if cn.IsClosing() {
+		return true
+	}
+	if p.opt.HealthCheck == nil || time.Since(cn.checkedAt()) < p.opt.HealthCheckIdle {
+		return false
+	}
+	if err := p.opt.HealthCheck(cn); err != nil {
+		log.Printf("health check failed: %s", err)
+		return true
+	}
+	cn.setCheckedAt(time.Now())
+	return false
+}
+
+func (p *ConnPool) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if p.closed() {
+			break
+		}
+		n := p.probeIdleConns(interval)
+		atomic.AddUint32(&p.stats.DeadConns, uint32(n))
+	}
+}
+
+// probeIdleConns checks idle connections unchecked for the duration, and removes the dead
+func (p *ConnPool) probeIdleConns(d time.Duration) int {
+	var n int
+	for {
+		p.getTurn()
+
+		p.connsMu.Lock()
+		cn := p.popUnchecked(d)
+		p.connsMu.Unlock()
+
+		if cn == nil {
+			p.freeTurn()
+			break
+		}
+
+		if cn.IsClosing() || p.opt.HealthCheck(cn) != nil {
+			p.Remove(cn)
+			n++
+			continue
+		}
+		cn.setCheckedAt(time.Now())
+		p.putIdle(cn)
+	}
+	return n
+}
+
+func (p *ConnPool) popUnchecked(d time.Duration) *Conn {
+	for i, cn := range p.idleConns {
+		if time.Since(cn.checkedAt()) >= d {
+			p.idleConns = append(p.idleConns[:i], p.idleConns[i+1:]...)
+			p.idleConnsLen--
+			return cn
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package pool
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// turns a semaphore of connections, waiters are served first-in first-out
+type turns struct {
+	mu      sync.Mutex
+	free    int
+	waiters list.List // of chan struct{}
+}
+
+func newTurns(n int) *turns {
+	return &turns{free: n}
+}
+
+// acquire waits for a turn until ctx is done or timeout if positive
+func (t *turns) acquire(ctx context.Context, timeout time.Duration) error {
+	t.mu.Lock()
+	if t.free > 0 && t.waiters.Len() == 0 {
+		t.free--
+		t.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	elem := t.waiters.PushBack(ready)
+	t.mu.Unlock()
+
+	var timeoutC <-chan time.Time
+	if timeout > 0 {
+		timer := timers.Get().(*time.Timer)
+		timer.Reset(timeout)
+		defer func() {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timers.Put(timer)
+		}()
+		timeoutC = timer.C
+	}
+
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeoutC:
+		err = ErrPoolTimeout
+	}
+
+	t.mu.Lock()
+	select {
+	case <-ready:
+		// granted while giving up, pass it to the next
+		t.mu.Unlock()
+		t.release()
+		return err
+	default:
+		t.waiters.Remove(elem)
+	}
+	t.mu.Unlock()
+	return err
+}
+
+// release gives the turn to the first waiter
+func (t *turns) release() {
+	t.mu.Lock()
+	if front := t.waiters.Front(); front != nil {
+		t.waiters.Remove(front)
+		close(front.Value.(chan struct{}))
+	} else {
+		t.free++
+	}
+	t.mu.Unlock()
+}
+
+// waiting returns number of waiters
+func (t *turns) waiting() int {
+	t.mu.Lock()
+	n := t.waiters.Len()
+	t.mu.Unlock()
+	return n
+}
@@ -0,0 +1,234 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+type nopClient struct {
+	ldap.Client
+	closed bool
+}
+
+func (c *nopClient) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *nopClient) IsClosing() bool {
+	return c.closed
+}
+
+func newNopPool(size int, timeout time.Duration) *ConnPool {
+	return NewPool(&Options{
+		Factory: func() (ldap.Client, error) {
+			return &nopClient{}, nil
+		},
+		PoolSize:    size,
+		PoolTimeout: timeout,
+	})
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestBreaker(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	var changes []string
+	b := NewBreaker("ldap://a", &BreakerOptions{
+		Threshold: 2,
+		BaseDelay: time.Second,
+		MaxDelay:  3 * time.Second,
+		Now:       clock.Now,
+		OnStateChange: func(name string, from, to BreakerState) {
+			assert.Equal(t, "ldap://a", name)
+			changes = append(changes, from.String()+">"+to.String())
+		},
+	})
+	errDial := errors.New("refused")
+
+	assert.NoError(t, b.Allow())
+	b.Failure(errDial)
+	assert.Equal(t, StateClosed, b.State())
+	assert.True(t, b.Ready())
+	b.Failure(errDial)
+	assert.Equal(t, StateOpen, b.State())
+	assert.False(t, b.Ready())
+
+	err := b.Allow()
+	assert.ErrorIs(t, err, ErrBreakerOpen)
+	assert.ErrorIs(t, err, errDial)
+
+	st := b.Status()
+	assert.Equal(t, 2, st.Failures)
+	assert.Equal(t, "refused", st.LastError)
+	delay := st.RetryAt.Sub(clock.now)
+	assert.True(t, delay >= time.Second/2 && delay <= time.Second, delay)
+
+	// one trial after the delay
+	clock.now = st.RetryAt
+	assert.True(t, b.Ready())
+	assert.NoError(t, b.Allow())
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.ErrorIs(t, b.Allow(), ErrBreakerOpen, "only one trial")
+
+	// failed trial doubles the delay
+	b.Failure(errDial)
+	delay = b.Status().RetryAt.Sub(clock.now)
+	assert.True(t, delay >= time.Second && delay <= 2*time.Second, delay)
+
+	for i := 0; i < 5; i++ {
+		clock.now = b.Status().RetryAt
+		assert.NoError(t, b.Allow())
+		b.Failure(errDial)
+	}
+	delay = b.Status().RetryAt.Sub(clock.now)
+	assert.True(t, delay <= 3*time.Second, "max delay %s", delay)
+
+	clock.now = b.Status().RetryAt
+	assert.NoError(t, b.Allow())
+	b.Success()
+	assert.Equal(t, StateClosed, b.State())
+	assert.Equal(t, BreakerStatus{State: StateClosed}, b.Status())
+
+	assert.Equal(t, []string{"closed>open", "open>half-open", "half-open>open"}, changes[:3])
+	assert.Equal(t, "half-open>closed", changes[len(changes)-1])
+
+	buf, err := json.Marshal(b.Status())
+	assert.NoError(t, err)
+	assert.Contains(t, string(buf), `"state":"closed"`)
+}
+
+func TestPoolBreaker(t *testing.T) {
+	var dials int
+	errDial := errors.New("refused")
+	p := NewPool(&Options{
+		Factory: func() (ldap.Client, error) {
+			dials++
+			return nil, errDial
+		},
+		PoolSize:    2,
+		PoolTimeout: time.Second,
+		Breaker:     NewBreaker("ldap://a", &BreakerOptions{Threshold: 3, BaseDelay: time.Hour}),
+	})
+	defer p.Close()
+
+	for i := 0; i < 3; i++ {
+		_, err := p.Get()
+		assert.Equal(t, errDial, err)
+	}
+	_, err := p.GetNew()
+	assert.ErrorIs(t, err, ErrBreakerOpen)
+	assert.Equal(t, 3, dials)
+	assert.Equal(t, StateOpen, p.Breaker().State())
+	assert.Zero(t, p.Len())
+}
+
+func TestGetContext(t *testing.T) {
+	p := newNopPool(1, time.Hour)
+	defer p.Close()
+
+	cn, err := p.Get()
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = p.GetContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	_, err = p.GetNewContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := p.GetContext(ctx)
+		done <- err
+	}()
+	assert.Eventually(t, func() bool { return p.Stats().Waiters == 1 }, time.Second, time.Millisecond)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assert.Zero(t, p.Stats().Waiters)
+
+	p.Put(cn)
+	cn, err = p.GetContext(context.Background())
+	assert.NoError(t, err, "the turn of cancelled waiter is not lost")
+	p.Put(cn)
+
+	stats := p.Stats()
+	assert.Zero(t, stats.Timeouts)
+	assert.Equal(t, uint64(5), stats.Waits.Count)
+	assert.Len(t, stats.Waits.Counts, len(waitBounds)+1)
+	assert.True(t, stats.Waits.Sum >= 10*time.Millisecond)
+	assert.True(t, stats.Waits.Counts[0] >= 2, "two immediate")
+
+	p = newNopPool(1, 10*time.Millisecond)
+	defer p.Close()
+	_, err = p.Get()
+	assert.NoError(t, err)
+	_, err = p.Get()
+	assert.Equal(t, ErrPoolTimeout, err)
+	assert.Equal(t, uint32(1), p.Stats().Timeouts)
+}
+
+func TestGetFIFO(t *testing.T) {
+	p := newNopPool(1, time.Second)
+	defer p.Close()
+
+	cn, err := p.Get()
+	assert.NoError(t, err)
+
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cn, err := p.Get()
+			if assert.NoError(t, err) {
+				mu.Lock()
+				order = append(order, i)
+				mu.Unlock()
+				p.Put(cn)
+			}
+		}(i)
+		// wait in order
+		assert.Eventually(t, func() bool { return p.Stats().Waiters == uint32(i+1) }, time.Second, time.Millisecond)
+	}
+	p.Put(cn)
+	wg.Wait()
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, order)
+}
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]time.Duration{time.Millisecond, time.Second})
+	for _, d := range []time.Duration{0, time.Millisecond, 2 * time.Millisecond, time.Minute} {
+		h.observe(d)
+	}
+	s := h.snapshot()
+	assert.Equal(t, []uint64{2, 1, 1}, s.Counts)
+	assert.Equal(t, uint64(4), s.Count)
+	assert.Equal(t, time.Minute+3*time.Millisecond, s.Sum)
+
+	var sum Histogram
+	sum.Add(s)
+	sum.Add(s)
+	assert.Equal(t, []uint64{4, 2, 2}, sum.Counts)
+	assert.Equal(t, uint64(8), sum.Count)
+	assert.Equal(t, s.Bounds, sum.Bounds)
+	assert.Equal(t, []uint64{2, 1, 1}, s.Counts, "not changed")
+}
@@ -0,0 +1,112 @@
+package ldap
+
+import (
+	"errors"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// nolint
+var (
+	ErrPasswordExpired    = errors.New("Password expired")
+	ErrAccountLocked      = errors.New("Account locked")
+	ErrPasswordMustChange = errors.New("Password must be changed") // refused by Store.Authenticate
+)
+
+// PasswordPolicy state of password policy returned on bind,
+// see also: https://tools.ietf.org/html/draft-behera-ldap-password-policy-10
+type PasswordPolicy struct {
+	Expired     bool   `json:"expired,omitempty"`
+	Locked      bool   `json:"locked,omitempty"`
+	MustChange  bool   `json:"mustChange,omitempty"` // changeAfterReset
+	GraceLogins int64  `json:"graceLogins"`          // remaining logins with an expired password, -1 if unknown
+	ExpiresIn   int64  `json:"expiresIn"`            // seconds until password expires, -1 if unknown
+	ErrorCode   int8   `json:"errorCode"`            // error of Behera draft, -1 if none
+	Error       string `json:"error,omitempty"`
+}
+
+// Warning reports whether the password is going to expire or already expired in grace
+func (pp *PasswordPolicy) Warning() bool {
+	return pp.ExpiresIn >= 0 || pp.GraceLogins >= 0
+}
+
+// PolicyError failed authentication with password policy state,
+// it matches ErrLogin and one of ErrPasswordExpired, ErrAccountLocked, ErrPasswordMustChange
+type PolicyError struct {
+	Policy *PasswordPolicy
+	Err    error
+}
+
+func (e *PolicyError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap ...
+func (e *PolicyError) Unwrap() []error {
+	return []error{e.Err, ErrLogin}
+}
+
+// parsePasswordPolicy return nil if no policy control found
+func parsePasswordPolicy(controls []ldap.Control) *PasswordPolicy {
+	var pp *PasswordPolicy
+	ensure := func() {
+		if pp == nil {
+			pp = &PasswordPolicy{GraceLogins: -1, ExpiresIn: -1, ErrorCode: -1}
+		}
+	}
+	if c, ok := ldap.FindControl(controls, ldap.ControlTypeBeheraPasswordPolicy).(*ldap.ControlBeheraPasswordPolicy); ok {
+		ensure()
+		pp.ExpiresIn = c.Expire
+		pp.GraceLogins = c.Grace
+		pp.ErrorCode = c.Error
+		pp.Error = c.ErrorString
+		switch c.Error {
+		case ldap.BeheraPasswordExpired:
+			pp.Expired = true
+		case ldap.BeheraAccountLocked:
+			pp.Locked = true
+		case ldap.BeheraChangeAfterReset:
+			pp.MustChange = true
+		}
+	}
+	if c, ok := ldap.FindControl(controls, ldap.ControlTypeVChuPasswordMustChange).(*ldap.ControlVChuPasswordMustChange); ok && c.MustChange {
+		ensure()
+		pp.MustChange = true
+	}
+	if c, ok := ldap.FindControl(controls, ldap.ControlTypeVChuPasswordWarning).(*ldap.ControlVChuPasswordWarning); ok {
+		ensure()
+		if pp.ExpiresIn < 0 {
+			pp.ExpiresIn = c.Expire
+		}
+	}
+	return pp
+}
+
+// err returns a *PolicyError if the state refuses the login,
+// MustChange is not refused, the caller forces a password change with the state returned
+func (pp *PasswordPolicy) err() error {
+	if pp == nil {
+		return nil
+	}
+	switch {
+	case pp.Locked:
+		return &PolicyError{Policy: pp, Err: ErrAccountLocked}
+	case pp.Expired:
+		return &PolicyError{Policy: pp, Err: ErrPasswordExpired}
+	}
+	return nil
+}
+
+// opWithPolicy like opWithDN, and sends the password policy request control on bind
+func (ls *ldapSource) opWithPolicy(dn, passwd string, pp **PasswordPolicy, op opFunc) error {
+	if dn == "" {
+		return ErrEmptyDN
+	}
+	if passwd == "" {
+		return ErrEmptyPwd
+	}
+	br := ldap.NewSimpleBindRequest(dn, passwd, []ldap.Control{ldap.NewControlBeheraPasswordPolicy()})
+	return ls.opWithBind(br, func(r *ldap.SimpleBindResult) {
+		*pp = parsePasswordPolicy(r.Controls)
+	}, op)
+}
@@ -0,0 +1,125 @@
+package ldap
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePasswordPolicy(t *testing.T) {
+	assert.Nil(t, parsePasswordPolicy(nil))
+	assert.NoError(t, parsePasswordPolicy(nil).err())
+
+	c := ldap.NewControlBeheraPasswordPolicy()
+	c.Expire = 3600
+	pp := parsePasswordPolicy([]ldap.Control{c})
+	if assert.NotNil(t, pp) {
+		assert.True(t, pp.Warning())
+		assert.Equal(t, int64(3600), pp.ExpiresIn)
+		assert.Equal(t, int64(-1), pp.GraceLogins)
+		assert.Equal(t, int8(-1), pp.ErrorCode)
+		assert.NoError(t, pp.err())
+	}
+
+	c = ldap.NewControlBeheraPasswordPolicy()
+	c.Grace = 2
+	c.Error = ldap.BeheraPasswordExpired
+	c.ErrorString = ldap.BeheraPasswordPolicyErrorMap[c.Error]
+	pp = parsePasswordPolicy([]ldap.Control{c})
+	if assert.NotNil(t, pp) {
+		assert.True(t, pp.Expired)
+		assert.Equal(t, int64(2), pp.GraceLogins)
+		err := pp.err()
+		assert.ErrorIs(t, err, ErrPasswordExpired)
+		assert.ErrorIs(t, err, ErrLogin)
+		var pe *PolicyError
+		if assert.True(t, errors.As(err, &pe)) {
+			assert.Equal(t, pp, pe.Policy)
+		}
+	}
+
+	c = ldap.NewControlBeheraPasswordPolicy()
+	c.Error = ldap.BeheraAccountLocked
+	assert.ErrorIs(t, parsePasswordPolicy([]ldap.Control{c}).err(), ErrAccountLocked)
+
+	c = ldap.NewControlBeheraPasswordPolicy()
+	c.Error = ldap.BeheraChangeAfterReset
+	pp = parsePasswordPolicy([]ldap.Control{c})
+	if assert.NotNil(t, pp) {
+		assert.True(t, pp.MustChange)
+		assert.NoError(t, pp.err())
+	}
+
+	pp = parsePasswordPolicy([]ldap.Control{
+		&ldap.ControlVChuPasswordMustChange{MustChange: true},
+		&ldap.ControlVChuPasswordWarning{Expire: 60},
+	})
+	if assert.NotNil(t, pp) {
+		assert.True(t, pp.MustChange)
+		assert.Equal(t, int64(60), pp.ExpiresIn)
+		assert.NoError(t, pp.err())
+	}
+}
+
+func TestAuthenticateMustChange(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	dir.mustChange = map[string]bool{strings.ToLower(dn): true}
+	ls := dir.newSource()
+	defer ls.Close()
+
+	staff, pp, err := ls.AuthenticateWithPolicy("doe", "secret")
+	if assert.NoError(t, err) && assert.NotNil(t, staff) {
+		assert.Equal(t, "doe", staff.UID)
+		assert.Equal(t, dn, staff.DN)
+	}
+	if assert.NotNil(t, pp) {
+		assert.True(t, pp.MustChange)
+	}
+
+	_, _, err = ls.AuthenticateWithPolicy("doe", "bad")
+	assert.ErrorIs(t, err, ErrLogin)
+
+	err = ls.PasswordChange("doe", "secret", "secret2")
+	assert.NoError(t, err)
+	staff, pp, err = ls.AuthenticateWithPolicy("doe", "secret2")
+	assert.NoError(t, err)
+	assert.NotNil(t, staff)
+	assert.Nil(t, pp)
+}
+
+func TestStoreAuthenticateMustChange(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	dir.mustChange = map[string]bool{strings.ToLower(dn): true}
+	ls := dir.newSource()
+	ls.recordLogins = true
+	s := &Store{sources: []*ldapSource{ls}}
+	defer s.Close()
+
+	staff, err := s.Authenticate("doe", "secret")
+	assert.Nil(t, staff)
+	assert.ErrorIs(t, err, ErrPasswordMustChange)
+	assert.ErrorIs(t, err, ErrLogin)
+	var pe *PolicyError
+	if assert.ErrorAs(t, err, &pe) {
+		assert.True(t, pe.Policy.MustChange)
+	}
+	assert.Empty(t, dir.callsOf("modify"), "login not recorded")
+
+	// the state is kept for AuthenticateWithPolicy
+	staff, pp, err := s.AuthenticateWithPolicy("doe", "secret")
+	if assert.NoError(t, err) && assert.NotNil(t, pp) {
+		assert.Equal(t, "doe", staff.UID)
+		assert.True(t, pp.MustChange)
+	}
+
+	assert.NoError(t, s.PasswordChange("doe", "secret", "secret2"))
+	staff, err = s.Authenticate("doe", "secret2")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "doe", staff.UID)
+	}
+}
@@ -0,0 +1,255 @@
+package ldap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/liut/staffio-backend/seal"
+)
+
+// attributes of sealed values, see staffioPerson in tests/ldap/schema/staffio.schema
+const (
+	attrSealed     = "sealedValue" // <name>:<sealed value>
+	attrBlindIndex = "blindIndex"  // <name>:<HMAC of value>
+)
+
+// DefaultSealedAttributes ...
+var DefaultSealedAttributes = []string{"idcnNumber"}
+
+// sealableFields fields of People which can be sealed, by attribute name
+var sealableFields = map[string]func(u *People) *string{
+	"idcnNumber":  func(u *People) *string { return &u.IDCN },
+	"mobile":      func(u *People) *string { return &u.Mobile },
+	"dateOfBirth": func(u *People) *string { return (*string)(&u.Birthday) },
+	"dateOfJoin":  func(u *People) *string { return (*string)(&u.JoinDate) },
+}
+
+func checkSealed(attrs []string) error {
+	for _, name := range attrs {
+		if _, ok := sealableFields[name]; !ok {
+			return fmt.Errorf("ldap: attribute %q can not be sealed", name)
+		}
+	}
+	return nil
+}
+
+// isSealed reports whether attribute name is sealed, never in Active Directory
+func (ls *ldapSource) isSealed(name string) bool {
+	if ls.sealer == nil || ls.isAD {
+		return false
+	}
+	for _, s := range ls.sealed {
+		if strings.EqualFold(s, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// toPeople maps entry to People, and opens sealed values
+func (ls *ldapSource) toPeople(entry *ldap.Entry) *People {
+	u := entryToPeople(entry)
+	if ls.sealer == nil || ls.isAD {
+		return u
+	}
+	values, err := ls.openSealed(entry)
+	if err != nil {
+		logger().Infow("open sealed fail", "dn", entry.DN, "err", err)
+	}
+	for name, value := range values {
+		if field, ok := sealableFields[name]; ok {
+			*field(u) = value
+		}
+	}
+	return u
+}
+
+// openSealed returns plain values of sealed attributes of entry by name, and the last failure
+func (ls *ldapSource) openSealed(entry *ldap.Entry) (values map[string]string, err error) {
+	values, _, err = ls.openSealedOf(entry)
+	return
+}
+
+// openSealedOf returns plain values of sealed attributes of entry by name, current sealed values by name
+// which need no sealing again, and the last failure
+func (ls *ldapSource) openSealedOf(entry *ldap.Entry) (values, current map[string]string, err error) {
+	values = make(map[string]string)
+	current = make(map[string]string)
+	uid := entry.GetAttributeValue("uid")
+	for _, v := range entry.GetAttributeValues(attrSealed) {
+		name, sealed, ok := strings.Cut(v, ":")
+		if !ok {
+			err = fmt.Errorf("%w: %s", seal.ErrMalformed, attrSealed)
+			continue
+		}
+		plain, e := ls.sealer.Open(sealed, sealAAD(name, uid))
+		if e == nil {
+			if !ls.sealer.Stale(sealed) {
+				current[name] = sealed
+			}
+		} else if plain, e = ls.sealer.Open(sealed, []byte(name)); e != nil { // sealed before bound to uid
+			err = fmt.Errorf("%s: %w", name, e)
+			continue
+		}
+		values[name] = string(plain)
+	}
+	return
+}
+
+// sealAAD returns the additional data of a sealed value of attribute name of People uid,
+// so a value copied to the entry of another fails to open
+func sealAAD(name, uid string) []byte {
+	return []byte(name + "\x00" + uid)
+}
+
+// sealAdd moves sealed attributes of ar out of plaintext
+func (ls *ldapSource) sealAdd(ar *ldap.AddRequest, staff *People) error {
+	if ls.sealer == nil || ls.isAD {
+		return nil
+	}
+	attrs := ar.Attributes[:0]
+	for _, a := range ar.Attributes {
+		if !ls.isSealed(a.Type) {
+			attrs = append(attrs, a)
+		}
+	}
+	ar.Attributes = attrs
+
+	values := make(map[string]string)
+	for _, name := range ls.sealed {
+		if v := *sealableFields[name](staff); v != "" {
+			values[name] = v
+		}
+	}
+	sealed, indexes, err := ls.sealValues(values, nil, staff.UID)
+	if err != nil || len(sealed) == 0 {
+		return err
+	}
+	ar.Attribute(attrSealed, sealed)
+	ar.Attribute(attrBlindIndex, indexes)
+	return nil
+}
+
+// wantOf returns wanted values of staff, empty values are unchanged
+func wantOf(staff *People) func(name string) *string {
+	return func(name string) *string {
+		if v := sealableFields[name](staff); *v != "" {
+			return v
+		}
+		return nil
+	}
+}
+
+// sealModify moves changes of sealed attributes of mr out of plaintext, values sealed by an old key or without uid
+// are sealed again,
+// want returns the new value of a sealed attribute, nil if unchanged, empty to clear
+func (ls *ldapSource) sealModify(mr *ldap.ModifyRequest, entry *ldap.Entry, want func(name string) *string) error {
+	if ls.sealer == nil || ls.isAD {
+		return nil
+	}
+	changes := mr.Changes[:0]
+	for _, c := range mr.Changes {
+		if !ls.isSealed(c.Modification.Type) {
+			changes = append(changes, c)
+		}
+	}
+	mr.Changes = changes
+
+	// keep still valid sealed values by name
+	values, keep, err := ls.openSealedOf(entry)
+	if err != nil { // not to lose values can not be opened
+		return err
+	}
+	changed := len(keep) != len(entry.GetAttributeValues(attrSealed))
+	for _, name := range ls.sealed {
+		if plain := entry.GetAttributeValue(name); plain != "" { // written before sealed
+			mr.Replace(name, nil)
+			if _, ok := values[name]; !ok {
+				values[name] = plain
+			}
+			changed = true
+		}
+		if v := want(name); v != nil && *v != values[name] {
+			if *v == "" {
+				delete(values, name)
+			} else {
+				values[name] = *v
+			}
+			delete(keep, name)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	sealed, indexes, err := ls.sealValues(values, keep, entry.GetAttributeValue("uid"))
+	if err != nil {
+		return err
+	}
+	mr.Replace(attrSealed, sealed)
+	mr.Replace(attrBlindIndex, indexes)
+	return nil
+}
+
+// dropUnchanged removes changes of sealed attributes of mr equal to the opened values of entry,
+// which look changed as their plaintext is absent from entry
+func (ls *ldapSource) dropUnchanged(mr *ldap.ModifyRequest, entry *ldap.Entry) error {
+	if ls.sealer == nil || ls.isAD {
+		return nil
+	}
+	values, err := ls.openSealed(entry)
+	if err != nil {
+		return err
+	}
+	changes := mr.Changes[:0]
+	for _, c := range mr.Changes {
+		name, vals := c.Modification.Type, c.Modification.Vals
+		if ls.isSealed(name) && len(vals) == 1 && sameValue(name, vals[0], values[name]) {
+			continue
+		}
+		changes = append(changes, c)
+	}
+	mr.Changes = changes
+	return nil
+}
+
+// sameValue reports whether a and b are the same value of attribute name, dates as YYYYMMDD
+func sameValue(name, a, b string) bool {
+	if _, ok := dateAttrs[name]; ok {
+		return Date(a).LDAP() == Date(b).LDAP()
+	}
+	return a == b
+}
+
+var dateAttrs = map[string]struct{}{"dateOfBirth": {}, "dateOfJoin": {}}
+
+// sealValues seals values of People uid except those in keep, returns values of attrSealed and attrBlindIndex sorted by name
+func (ls *ldapSource) sealValues(values, keep map[string]string, uid string) (sealed, indexes []string, err error) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s, ok := keep[name]
+		if !ok {
+			if s, err = ls.sealer.Seal([]byte(values[name]), sealAAD(name, uid)); err != nil {
+				return nil, nil, err
+			}
+		}
+		sealed = append(sealed, name+":"+s)
+		indexes = append(indexes, name+":"+ls.sealer.Index(name, values[name]))
+	}
+	return
+}
+
+// eqFilter returns an equality filter of attribute name, by the blind index if it is sealed
+func (ls *ldapSource) eqFilter(name, value string) string {
+	if ls.isSealed(name) {
+		return "(" + attrBlindIndex + "=" + ldap.EscapeFilter(name+":"+ls.sealer.Index(name, value)) + ")"
+	}
+	return "(" + name + "=" + ldap.EscapeFilter(value) + ")"
+}
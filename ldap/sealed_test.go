@@ -0,0 +1,157 @@
+package ldap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio-backend/seal"
+)
+
+func newFakeSealer(t *testing.T, current string) *seal.Sealer {
+	keys, err := seal.NewStaticKeys(current, map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 32),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return seal.New(keys, []byte("index"))
+}
+
+func TestSealed(t *testing.T) {
+	const idcn = "110101199001011234"
+	dir := newFakeDirectory()
+	ls := dir.newSource()
+	defer ls.Close()
+	ls.sealer = newFakeSealer(t, "k1")
+	ls.sealed = []string{"idcnNumber", "mobile"}
+
+	dn := ls.UDN("doe")
+	_, err := ls.savePeople(&People{UID: "doe", Surname: "Doe", GivenName: "J", IDCN: idcn, Mobile: "13800138000"})
+	assert.NoError(t, err)
+	assert.Empty(t, dir.attr(dn, "idcnNumber"))
+	assert.Empty(t, dir.attr(dn, "mobile"))
+	sealed := dir.attr(dn, attrSealed)
+	assert.True(t, strings.HasPrefix(sealed, "idcnNumber:v1.k1."), sealed)
+	assert.NotContains(t, sealed, idcn)
+
+	staff, err := ls.GetPeople("doe")
+	if assert.NoError(t, err) {
+		assert.Equal(t, idcn, staff.IDCN)
+		assert.Equal(t, "13800138000", staff.Mobile)
+	}
+
+	// exact match by the blind index
+	data := ls.List(&Spec{IDCN: idcn})
+	if assert.Len(t, data, 1) {
+		assert.Equal(t, "doe", data[0].UID)
+	}
+	assert.Len(t, ls.List(&Spec{Mobile: "13800138000"}), 1)
+	assert.Empty(t, ls.List(&Spec{IDCN: "110101199001019999"}))
+
+	// unchanged, not sealed again
+	_, err = ls.savePeople(&People{UID: "doe", Surname: "Doe", GivenName: "J", IDCN: idcn})
+	assert.NoError(t, err)
+	assert.Equal(t, sealed, dir.attr(dn, attrSealed))
+
+	// rotate, sealed again by the current key on update
+	ls.sealer = newFakeSealer(t, "k2")
+	staff, err = ls.GetPeople("doe")
+	if assert.NoError(t, err) {
+		assert.Equal(t, idcn, staff.IDCN)
+	}
+	_, err = ls.savePeople(&People{UID: "doe", Surname: "Doe", GivenName: "J", Mobile: "13900139000"})
+	assert.NoError(t, err)
+	for _, v := range dir.get(dn)[strings.ToLower(attrSealed)] {
+		assert.Contains(t, v, ":v1.k2.")
+	}
+	assert.Len(t, ls.List(&Spec{IDCN: idcn}), 1)
+	assert.Len(t, ls.List(&Spec{Mobile: "13900139000"}), 1)
+	assert.Empty(t, ls.List(&Spec{Mobile: "13800138000"}))
+}
+
+func TestSealedIdentity(t *testing.T) {
+	const idcn = "110101199001011237"
+	dir := newFakeDirectory()
+	ls := dir.newSource()
+	defer ls.Close()
+	ls.sealer = newFakeSealer(t, "k1")
+	ls.sealed = DefaultSealedAttributes
+
+	dn, dn2 := ls.UDN("doe"), ls.UDN("cat")
+	_, err := ls.savePeople(&People{UID: "doe", Surname: "Doe", GivenName: "J", IDCN: idcn})
+	assert.NoError(t, err)
+	_, err = ls.savePeople(&People{UID: "cat", Surname: "Cat", GivenName: "C"})
+	assert.NoError(t, err)
+
+	// a value copied from the entry of another fails to open
+	dir.entries[strings.ToLower(dn2)]["sealedvalue"] = []string{dir.attr(dn, attrSealed)}
+	staff, err := ls.GetPeople("cat")
+	if assert.NoError(t, err) {
+		assert.Empty(t, staff.IDCN)
+	}
+	entry := dir.get(dn2)
+	_, err = ls.openSealed(ldap.NewEntry(dn2, map[string][]string{"uid": entry["uid"], attrSealed: entry["sealedvalue"]}))
+	assert.Error(t, err)
+
+	// a value sealed without uid still opens, and is sealed again on update
+	old, err := ls.sealer.Seal([]byte(idcn), []byte("idcnNumber"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	dir.entries[strings.ToLower(dn)]["sealedvalue"] = []string{"idcnNumber:" + old}
+	staff, err = ls.GetPeople("doe")
+	if assert.NoError(t, err) {
+		assert.Equal(t, idcn, staff.IDCN)
+	}
+	_, err = ls.savePeople(&People{UID: "doe", Surname: "Doe", GivenName: "J", Mobile: "13800138000"})
+	assert.NoError(t, err)
+	sealed := dir.attr(dn, attrSealed)
+	assert.NotEqual(t, "idcnNumber:"+old, sealed)
+	_, err = ls.sealer.Open(strings.TrimPrefix(sealed, "idcnNumber:"), []byte("idcnNumber"))
+	assert.Error(t, err)
+	staff, err = ls.GetPeople("doe")
+	if assert.NoError(t, err) {
+		assert.Equal(t, idcn, staff.IDCN)
+	}
+}
+
+func TestSealedMigrate(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	dir.entries[strings.ToLower(dn)]["idcnnumber"] = []string{"110101199001011234"}
+	ls := dir.newSource()
+	defer ls.Close()
+
+	staff, err := ls.GetPeople("doe")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "110101199001011234", staff.IDCN)
+	}
+
+	ls.sealer = newFakeSealer(t, "k1")
+	ls.sealed = DefaultSealedAttributes
+	assert.Len(t, ls.List(&Spec{IDCN: "110101199001011234"}), 0, "not indexed yet")
+	_, err = ls.savePeople(&People{UID: "doe", Surname: "doe"})
+	assert.NoError(t, err)
+	assert.Empty(t, dir.attr(dn, "idcnNumber"))
+	assert.Len(t, ls.List(&Spec{IDCN: "110101199001011234"}), 1)
+
+	// keep values can not be opened
+	ls.sealer = seal.New(mustStaticKeys(t, "k3"), []byte("index"))
+	_, err = ls.savePeople(&People{UID: "doe", Surname: "doe", IDCN: "110101199001019999"})
+	assert.ErrorIs(t, err, seal.ErrUnknownKey)
+
+	assert.Error(t, checkSealed([]string{"mail"}))
+}
+
+func mustStaticKeys(t *testing.T, id string) seal.KeyProvider {
+	keys, err := seal.NewStaticKeys(id, map[string][]byte{id: bytes.Repeat([]byte{3}, 16)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
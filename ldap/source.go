@@ -1,8 +1,10 @@
 package ldap
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"strings"
 	"sync"
 	"time"
@@ -11,10 +13,15 @@ import (
 
 	"github.com/liut/staffio-backend/ldap/pool"
 	"github.com/liut/staffio-backend/model"
+	"github.com/liut/staffio-backend/passwd"
+	"github.com/liut/staffio-backend/seal"
 )
 
-// PoolStats ...
-type PoolStats = pool.Stats
+// PoolStats stats of pools, embedded is the main pool of service account
+type PoolStats struct {
+	pool.Stats
+	Auth pool.Stats `json:"auth"` // pool of user binds
+}
 
 // Group ...
 type Group = model.Group
@@ -28,6 +35,9 @@ type Peoples = model.Peoples
 // Spec ...
 type Spec = model.Spec
 
+// Date ...
+type Date = model.Date
+
 // Basic LDAP authentication service
 type ldapSource struct {
 	Addr   string      // LDAP address with host and port
@@ -35,8 +45,25 @@ type ldapSource struct {
 	Domain string      // Domain of userPrincipalName
 	BindDN string      // default reader dn
 	Passwd string      // reader passwd
-	cp     pool.Pooler // conn
+	cp     pool.Pooler // conn of service account
+	ap     pool.Pooler // conn of user binds, like authentication
+	cb     *pool.Breaker
 	isAD   bool
+
+	pwdMode   string
+	pwdScheme string
+	pwdExt    *int32 // atomic, support of Password Modify: 0 unknown, 1 yes, 2 no
+	assertCtl *int32 // atomic, support of assertion control: 0 unknown, 1 yes, 2 no
+
+	tracer Tracer          // nil to disable
+	ctx    context.Context // parent of spans, see Store.WithContext
+
+	sealer *seal.Sealer // nil to disable
+	sealed []string     // names of sealed attributes
+
+	fields FieldPolicy // nil for DefaultFieldPolicy
+
+	recordLogins bool // write lastLoginTime and loginCount on login
 }
 
 // nolint
@@ -49,10 +76,12 @@ var (
 	ErrEmptyPwd    = errors.New("ldap passwd is empty")
 	ErrEmptyUID    = errors.New("ldap uid is empty")
 	ErrInvalidUID  = errors.New("ldap uid is invalid")
-	ErrLogin       = errors.New("Incorrect Username/Password")
+	ErrLogin       = model.ErrLogin
 	ErrNotFound    = errors.New("Not Found")
 	ErrUnsupport   = errors.New("Unsupported")
 
+	ErrPasswordRejected = errors.New("Password rejected by server")
+
 	userDnFmt = "uid=%s,ou=people,%s"
 
 	once sync.Once
@@ -60,18 +89,50 @@ var (
 
 // newSource Add a new source (LDAP directory) to the global pool
 func newSource(cfg *Config) (*ldapSource, error) {
+	var bopt pool.BreakerOptions
+	if cfg.Breaker != nil {
+		bopt = *cfg.Breaker
+	}
+	onChange := bopt.OnStateChange
+	bopt.OnStateChange = func(name string, from, to pool.BreakerState) {
+		logger().Infow("circuit breaker state changed", "addr", name, "from", from, "to", to)
+		if onChange != nil {
+			onChange(name, from, to)
+		}
+	}
+	cb := pool.NewBreaker(cfg.Addr, &bopt)
 
 	opt := &pool.Options{
 		Factory: func() (ldap.Client, error) {
 			logger().Debugw("dial to ldap", "addr", cfg.Addr)
-			return ldap.DialURL(cfg.Addr, ldap.DialWithTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+			c, err := ldap.DialURL(cfg.Addr, ldap.DialWithTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+			if err != nil {
+				return nil, err
+			}
+			return observeClient(c, cfg.Addr, cfg.Observer), nil
 		},
 		PoolSize:           DefaultPoolSize,
 		PoolTimeout:        30 * time.Second,
 		MaxConnAge:         25 * time.Minute,
 		IdleTimeout:        5 * time.Minute,
 		IdleCheckFrequency: 2 * time.Minute,
+		KeepAliveInterval:  cfg.KeepAlive,
+		Breaker:            cb,
 	}
+	if cfg.HealthCheckIdle >= 0 {
+		opt.HealthCheck = ping
+		opt.HealthCheckIdle = cfg.HealthCheckIdle
+		if opt.HealthCheckIdle == 0 {
+			opt.HealthCheckIdle = DefaultHealthCheckIdle
+		}
+	}
+
+	aopt := *opt
+	aopt.PoolSize = cfg.AuthPoolSize
+	if aopt.PoolSize <= 0 {
+		aopt.PoolSize = DefaultAuthPoolSize
+	}
+	aopt.PoolTimeout = 10 * time.Second
 
 	ls := &ldapSource{
 		Addr:   cfg.Addr,
@@ -80,15 +141,57 @@ func newSource(cfg *Config) (*ldapSource, error) {
 		BindDN: cfg.Bind,
 		Passwd: cfg.Passwd,
 		cp:     pool.NewPool(opt),
+		ap:     pool.NewPool(&aopt),
+		cb:     cb,
+
+		pwdMode:   cfg.PasswordMode,
+		pwdScheme: cfg.PasswordScheme,
+		pwdExt:    new(int32),
+		assertCtl: new(int32),
+
+		tracer: cfg.Tracer,
+
+		sealer: cfg.Sealer,
+		sealed: cfg.SealedAttributes,
+
+		fields: cfg.FieldPolicy,
+
+		recordLogins: cfg.RecordLogins,
+	}
+	if ls.pwdScheme == "" {
+		ls.pwdScheme = passwd.DefaultScheme
+	}
+	if ls.sealer != nil && len(ls.sealed) == 0 {
+		ls.sealed = DefaultSealedAttributes
+	}
+	if err := checkSealed(ls.sealed); err != nil {
+		ls.Close()
+		return nil, err
 	}
 
 	return ls, nil
 }
 
+// available reports whether the host may be dialed
+func (ls *ldapSource) available() bool {
+	return ls.cb == nil || ls.cb.Ready()
+}
+
 func (ls *ldapSource) Close() {
 	if ls.cp != nil {
 		ls.cp.Close()
 	}
+	if ls.ap != nil {
+		ls.ap.Close()
+	}
+}
+
+// poolOf returns the pool for binding as dn
+func (ls *ldapSource) poolOf(dn string) pool.Pooler {
+	if dn == ls.BindDN || ls.ap == nil {
+		return ls.cp
+	}
+	return ls.ap
 }
 
 func (ls *ldapSource) UDN(uid string) string {
@@ -149,7 +252,10 @@ func ldapEntryReady(c ldap.Client, et *entryType, name, base string) (exist *lda
 	return
 }
 
-func ldapFindOne(c ldap.Client, baseDN, filter string, attrs ...string) (*ldap.Entry, error) {
+func ldapFindOne(c ldap.Client, baseDN, filter string, attrs ...string) (entry *ldap.Entry, err error) {
+	span := startSpan(c, SpanFindOne, Attr{AttrBase, baseDN}, Attr{AttrFilter, redactFilter(filter)})
+	defer func() { endSpan(span, err) }()
+
 	search := ldap.NewSearchRequest(
 		baseDN,
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
@@ -180,26 +286,35 @@ func ldapFindOne(c ldap.Client, baseDN, filter string, attrs ...string) (*ldap.E
 
 // Authenticate
 func (ls *ldapSource) Authenticate(uid, passwd string) (staff *People, err error) {
+	staff, _, err = ls.AuthenticateWithPolicy(uid, passwd)
+	return
+}
+
+// AuthenticateWithPolicy return state of password policy if the server supports it
+func (ls *ldapSource) AuthenticateWithPolicy(uid, passwd string) (staff *People, pp *PasswordPolicy, err error) {
 	var entry *ldap.Entry
-	entry, err = ls.bind(uid, passwd)
+	entry, pp, err = ls.bind(uid, passwd)
 	logger().Debugw("authenticate fail", "uid", uid, "domain", ls.Domain, "err", err)
 	if err == nil {
-		staff = entryToPeople(entry)
+		staff = ls.toPeople(entry)
 	}
 	return
 }
 
-func (ls *ldapSource) bind(uid, passwd string) (entry *ldap.Entry, err error) {
+func (ls *ldapSource) bind(uid, passwd string) (entry *ldap.Entry, pp *PasswordPolicy, err error) {
 	et := ls.etUser()
 	dn := et.DN(uid, ls.Base)
-	err = ls.opWithDN(dn, passwd, func(c ldap.Client) (err error) {
+	var bound bool // the password is verified
+	err = ls.opWithPolicy(dn, passwd, &pp, func(c ldap.Client) (err error) {
+		bound = true
 		entry, err = ldapFindOne(c, dn, et.Filter, et.Attributes...)
 		return
 	})
 
 	if err == ErrNotFound && ls.isAD && ls.Domain != "" && !strings.Contains(uid, "@") {
 		dn = uid + "@" + ls.Domain
-		err = ls.opWithDN(dn, passwd, func(c ldap.Client) (err error) {
+		err = ls.opWithPolicy(dn, passwd, &pp, func(c ldap.Client) (err error) {
+			bound = true
 			entry, err = ldapFindOne(c, ls.Base, "(userPrincipalName="+dn+")", et.Attributes...)
 			if err == ErrNotFound {
 				entry, err = ldapFindOne(c, ls.Base, "(sAMAccountName="+uid+")", et.Attributes...)
@@ -208,15 +323,33 @@ func (ls *ldapSource) bind(uid, passwd string) (entry *ldap.Entry, err error) {
 		})
 	}
 	if err == ErrNotFound {
-		err = ls.opWithMan(func(c ldap.Client) error {
-			entry, err := ldapFindOne(c, ls.Base, et.oneFilter(uid), et.Attributes...)
-			if err != nil {
-				return err
+		var found *ldap.Entry
+		err = ls.opWithMan(func(c ldap.Client) (err error) {
+			found, err = ldapFindOne(c, ls.Base, et.oneFilter(uid), et.Attributes...)
+			return
+		})
+		if err == nil {
+			dn = found.DN
+			if err = ls.opWithPolicy(dn, passwd, &pp, nil); err == nil {
+				entry = found
 			}
-			return ls.opWithDN(entry.DN, passwd, nil)
+		}
+	}
+
+	// a password must be changed may do nothing else, such as reading its entry
+	if err != nil && bound && pp != nil && pp.MustChange {
+		err = ls.opWithMan(func(c ldap.Client) (err error) {
+			entry, err = ldapFindOne(c, dn, et.Filter, et.Attributes...)
+			return
 		})
 	}
 
+	if perr := pp.err(); perr != nil {
+		logger().Infow("LDAP Bind refused by password policy", "dn", dn, "policy", pp, "err", err)
+		entry, err = nil, perr
+		return
+	}
+
 	if err != nil {
 		logger().Infow("LDAP Bind failed", "dn", dn, "err", err)
 		if le, ok := err.(*ldap.Error); ok {
@@ -247,23 +380,166 @@ func (ls *ldapSource) opWithDN(dn, passwd string, op opFunc) error {
 	if passwd == "" {
 		return ErrEmptyPwd
 	}
-	c, err := ls.cp.Get()
-	if err == nil {
-		defer ls.cp.Put(c)
-		err = c.Bind(dn, passwd)
-		if err == nil {
-			logger().Debugw("bind ok", "dn", dn, "addr", ls.Addr, "pool.len", ls.cp.Len(), "pool.idleLen", ls.cp.IdleLen())
-			if op != nil {
-				return op(c)
-			}
-			return nil
+	return ls.opWithBind(ldap.NewSimpleBindRequest(dn, passwd, nil), nil, op)
+}
+
+// opWithBind bind with br and operate, onBind is called with the result of bind even if it failed,
+// the service account uses the main pool and users use the auth pool,
+// the operation is retried once on a new connection after a network error,
+// unless a write was sent, which might have been applied
+func (ls *ldapSource) opWithBind(br *ldap.SimpleBindRequest, onBind func(*ldap.SimpleBindResult), op opFunc) (err error) {
+	ls, span := ls.trace(SpanOp)
+	defer func() { endSpan(span, err) }()
+
+	cp := ls.poolOf(br.Username)
+	c, err := ls.getConn(cp, false)
+	if err != nil {
+		logger().Infow("get LDAP client from pool error", "addr", ls.Addr, "dn", br.Username, "err", err)
+		return err
+	}
+	wrote, err := ls.opWithConn(cp, c, br, onBind, op)
+	if !isNetworkError(err) {
+		return err
+	}
+	if wrote {
+		logger().Infow("network error after a write, not retried", "addr", ls.Addr, "dn", br.Username, "err", err)
+		return err
+	}
+
+	logger().Infow("network error, retry on a new connection", "addr", ls.Addr, "dn", br.Username, "err", err)
+	if c, err = ls.getConn(cp, true); err != nil {
+		logger().Infow("get new LDAP client error", "addr", ls.Addr, "dn", br.Username, "err", err)
+		return err
+	}
+	_, err = ls.opWithConn(cp, c, br, onBind, op)
+	return err
+}
+
+// opWithConn bind and operate on c, then release it, a connection with network error is removed,
+// wrote reports whether op sent a request which is not idempotent
+func (ls *ldapSource) opWithConn(cp pool.Pooler, c *pool.Conn, br *ldap.SimpleBindRequest,
+	onBind func(*ldap.SimpleBindResult), op opFunc) (wrote bool, err error) {
+	defer func() {
+		if isNetworkError(err) {
+			cp.Remove(c)
+		} else {
+			ls.release(cp, c)
 		}
+	}()
+
+	if err = ls.bindConn(c, br, onBind); err != nil {
+		return
+	}
+	if op != nil {
+		wc := &writeClient{Client: c}
+		err = op(ls.client(wc))
+		wrote = wc.wrote
+	}
+	return
+}
+
+// writeClient records whether a request which is not idempotent was sent
+type writeClient struct {
+	ldap.Client
+
+	wrote bool
+}
+
+func (c *writeClient) Add(req *ldap.AddRequest) error {
+	c.wrote = true
+	return c.Client.Add(req)
+}
+
+func (c *writeClient) Modify(req *ldap.ModifyRequest) error {
+	c.wrote = true
+	return c.Client.Modify(req)
+}
+
+func (c *writeClient) ModifyWithResult(req *ldap.ModifyRequest) (*ldap.ModifyResult, error) {
+	c.wrote = true
+	return c.Client.ModifyWithResult(req)
+}
+
+func (c *writeClient) ModifyDN(req *ldap.ModifyDNRequest) error {
+	c.wrote = true
+	return c.Client.ModifyDN(req)
+}
+
+func (c *writeClient) Del(req *ldap.DelRequest) error {
+	c.wrote = true
+	return c.Client.Del(req)
+}
+
+func (c *writeClient) Extended(req *ldap.ExtendedRequest) (*ldap.ExtendedResponse, error) {
+	c.wrote = true
+	return c.Client.Extended(req)
+}
+
+func (c *writeClient) PasswordModify(req *ldap.PasswordModifyRequest) (*ldap.PasswordModifyResult, error) {
+	c.wrote = true
+	return c.Client.PasswordModify(req)
+}
+
+// getConn gets a connection from cp, or a new one if fresh
+func (ls *ldapSource) getConn(cp pool.Pooler, fresh bool) (c *pool.Conn, err error) {
+	name := "main"
+	if cp != ls.cp {
+		name = "auth"
+	}
+	ls, span := ls.trace(SpanPoolGet, Attr{AttrPool, name})
+	defer func() { endSpan(span, err) }()
+
+	if fresh {
+		return cp.GetNewContext(ls.context())
+	}
+	return cp.GetContext(ls.context())
+}
+
+func isNetworkError(err error) bool {
+	return ldap.IsErrorWithCode(err, ldap.ErrorNetwork)
+}
+
+// ping reads root DSE as a health check of connection
+func ping(c *pool.Conn) error {
+	_, err := ldapRootDSE(c, "1.1")
+	return err
+}
+
+// bindConn skips the bind of service account if the connection is bound as it already,
+// a user always binds because the password must be verified
+func (ls *ldapSource) bindConn(c *pool.Conn, br *ldap.SimpleBindRequest, onBind func(*ldap.SimpleBindResult)) (err error) {
+	dn := br.Username
+	if onBind == nil && dn == ls.BindDN && br.Password == ls.Passwd && c.BoundDN() == dn {
+		return nil
+	}
+	_, span := ls.trace(SpanBind)
+	defer func() { endSpan(span, err) }()
+
+	c.SetBoundDN("")
+	r, err := c.SimpleBind(br)
+	if onBind != nil && r != nil {
+		onBind(r)
+	}
+	if err != nil {
 		logger().Infow("bind fail", "dn", dn, "err", err)
 		return err
 	}
+	c.SetBoundDN(dn)
+	logger().Debugw("bind ok", "dn", dn, "addr", ls.Addr, "pool.len", ls.cp.Len(), "pool.idleLen", ls.cp.IdleLen())
+	return nil
+}
 
-	logger().Infow("get LDAP client from pool error, %s:%v", ls.Addr, err)
-	return err
+// release puts the connection back, a connection of the main pool bound as a user
+// is reset to the service account first, and removed if the reset failed
+func (ls *ldapSource) release(cp pool.Pooler, c *pool.Conn) {
+	if dn := c.BoundDN(); cp == ls.cp && dn != "" && dn != ls.BindDN && ls.BindDN != "" {
+		if err := ls.bindConn(c, ldap.NewSimpleBindRequest(ls.BindDN, ls.Passwd, nil), nil); err != nil {
+			logger().Infow("reset bind fail", "dn", dn, "addr", ls.Addr, "err", err)
+			cp.Remove(c)
+			return
+		}
+	}
+	cp.Put(c)
 }
 
 func (ls *ldapSource) getGroupEntry(cn string) (*ldap.Entry, error) {
@@ -303,7 +579,7 @@ func (ls *ldapSource) GetPeople(uid string) (staff *People, err error) {
 		return nil, err
 	}
 
-	return entryToPeople(entry), nil
+	return ls.toPeople(entry), nil
 }
 
 func (ls *ldapSource) GetByDN(dn string) (staff *People, err error) {
@@ -314,7 +590,7 @@ func (ls *ldapSource) GetByDN(dn string) (staff *People, err error) {
 	var entry *ldap.Entry
 	entry, err = ls.getEntry(dn, et.Filter, et.Attributes...)
 	if err == nil {
-		staff = entryToPeople(entry)
+		staff = ls.toPeople(entry)
 	}
 	return
 }
@@ -342,40 +618,87 @@ func (ls *ldapSource) List(spec *Spec) (data Peoples) {
 	} else if len(spec.Email) > 0 {
 		filter = "(&(mail=" + ldap.EscapeFilter(spec.Email) + ")" + et.Filter + ")"
 	} else if len(spec.Mobile) > 0 {
-		filter = "(&(mobile=" + ldap.EscapeFilter(spec.Mobile) + ")" + et.Filter + ")"
+		filter = "(&" + ls.eqFilter("mobile", spec.Mobile) + et.Filter + ")"
+	} else if len(spec.IDCN) > 0 {
+		filter = "(&" + ls.eqFilter("idcnNumber", spec.IDCN) + et.Filter + ")"
+	}
+	if df := ls.dateFilter(spec) + ls.loginFilter(spec); df != "" {
+		filter = "(&" + filter + df + ")"
 	}
 	logger().Debugw("list", "filter", filter)
 	// TODO: other spec
 
+	attrs := et.Attributes
+	if spec.SkipPhoto {
+		attrs = withoutAttr(attrs, attrPhoto)
+	}
 	search := ldap.NewSearchRequest(
 		ls.Base,
 		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
 		filter,
-		et.Attributes,
+		attrs,
 		nil)
 
 	var (
 		sr *ldap.SearchResult
 	)
+	ls, span := ls.trace(SpanList, Attr{AttrBase, ls.Base}, Attr{AttrFilter, redactFilter(filter)})
 	err := ls.opWithMan(func(c ldap.Client) (err error) {
 		sr, err = c.SearchWithPaging(search, uint32(spec.Limit))
 		return
 	})
+	if err == nil {
+		span.SetAttributes(Attr{AttrEntries, len(sr.Entries)})
+	}
+	endSpan(span, err)
 	if err != nil {
 		logger().Infow("list fail", "search", search, "err", err)
 		return
 	}
 
 	if len(sr.Entries) > 0 {
-		data = make(Peoples, len(sr.Entries))
-		for i, entry := range sr.Entries {
-			data[i] = *entryToPeople(entry)
+		data = make(Peoples, 0, len(sr.Entries))
+		matchSealed := ls.isSealed("dateOfBirth") || ls.isSealed("dateOfJoin")
+		for _, entry := range sr.Entries {
+			u := ls.toPeople(entry)
+			if matchSealed && !spec.MatchDates(u) {
+				continue
+			}
+			data = append(data, *u)
 		}
 	}
 
 	return
 }
 
+// dateFilter returns conditions of date ranges and birth month in spec, sealed dates are matched after opened
+func (ls *ldapSource) dateFilter(spec *Spec) string {
+	var sb strings.Builder
+	rangeFilter := func(name string, r *model.DateRange) {
+		if r == nil || ls.isSealed(name) {
+			return
+		}
+		if !r.From.IsZero() {
+			sb.WriteString("(" + name + ">=" + ldap.EscapeFilter(r.From.LDAP()) + ")")
+		}
+		if !r.To.IsZero() {
+			sb.WriteString("(" + name + "<=" + ldap.EscapeFilter(r.To.LDAP()) + ")")
+		}
+	}
+	rangeFilter("dateOfBirth", spec.Birthday)
+	rangeFilter("dateOfJoin", spec.JoinDate)
+	if m := spec.BirthMonth; m >= time.January && m <= time.December && !ls.isSealed("dateOfBirth") {
+		// suffix of MMDD, numericString has no ordering of a part
+		days := time.Date(2000, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		sb.WriteString("(|")
+		for d := 1; d <= days; d++ {
+			fmt.Fprintf(&sb, "(dateOfBirth=*%02d%02d)", m, d)
+		}
+		sb.WriteString(")")
+	}
+	return sb.String()
+}
+
 func entryToPeople(entry *ldap.Entry) (u *People) {
 	u = &People{
 		DN:           entry.DN,
@@ -388,12 +711,13 @@ func entryToPeople(entry *ldap.Entry) (u *People) {
 		Nickname:     entry.GetAttributeValue("displayName"),
 		Mobile:       entry.GetAttributeValue("mobile"),
 		EmployeeType: entry.GetAttributeValue("employeeType"),
-		Birthday:     entry.GetAttributeValue("dateOfBirth"),
+		Birthday:     Date(entry.GetAttributeValue("dateOfBirth")),
 		AvatarPath:   entry.GetAttributeValue("avatarPath"),
 		Description:  entry.GetAttributeValue("description"),
-		JoinDate:     entry.GetAttributeValue("dateOfJoin"),
+		JoinDate:     Date(entry.GetAttributeValue("dateOfJoin")),
 		IDCN:         entry.GetAttributeValue("idcnNumber"),
 	}
+	u.Version, _ = versionOf(entry)
 	if str := entry.GetAttributeValue("sAMAccountName"); str != "" && u.UID == "" {
 		u.UID = str
 	}
@@ -401,38 +725,14 @@ func entryToPeople(entry *ldap.Entry) (u *People) {
 		u.Email = str
 	}
 
-	var err error
 	if str := entry.GetAttributeValue("employeeNumber"); str != "" {
 		u.EmployeeNumber = str
 	}
 
-	var t time.Time
-	if str := entry.GetAttributeValue("createdTime"); str != "" {
-		t, err = time.Parse(TimeLayout, str)
-		if err != nil {
-			logger().Infow("invalid time", "str", str, "err", err)
-		} else {
-			u.Created = &t
-		}
-	} else if str := entry.GetAttributeValue("createTimestamp"); str != "" {
-		if t, err = time.Parse(TimeLayout, str); err == nil {
-			u.Created = &t
-		}
-	}
-
-	if str := entry.GetAttributeValue("modifiedTime"); str != "" {
-		t, err = time.Parse(TimeLayout, str)
-		if err != nil {
-			logger().Infow("invalid time", "str", str, "err", err)
-		} else {
-			u.Modified = &t
-		}
-	} else if str := entry.GetAttributeValue("modifyTimestamp"); str != "" {
-		if t, err = time.Parse(TimeLayout, str); err == nil {
-			u.Modified = &t
-		}
-	}
-	if blob := entry.GetRawAttributeValue("jpegPhoto"); len(blob) > 0 {
+	u.Created = timeOf(entry, false, "createdTime", "createTimestamp", "whenCreated")
+	u.Modified = timeOf(entry, false, "modifiedTime", "modifyTimestamp", "whenChanged")
+	u.LastLogin, u.LogonCount = loginOf(entry)
+	if blob := entry.GetRawAttributeValue(attrPhoto); len(blob) > 0 {
 		u.JpegPhoto = blob
 	}
 	return
@@ -0,0 +1,324 @@
+package ldap
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio-backend/ldap/pool"
+	"github.com/liut/staffio-backend/model"
+)
+
+func TestBindState(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	ls := dir.newSource()
+	defer ls.Close()
+
+	// admin reads bind once
+	for i := 0; i < 3; i++ {
+		_, err := ls.GetPeople("doe")
+		assert.NoError(t, err)
+	}
+	if binds := dir.callsOf("bind"); assert.Len(t, binds, 1) {
+		assert.Equal(t, fakeAdminDN, binds[0].dn)
+	}
+
+	// a user binds in the auth pool, the service connection is untouched
+	staff, err := ls.Authenticate("doe", "secret")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "doe", staff.UID)
+	}
+	if binds := dir.callsOf("bind"); assert.Len(t, binds, 2) {
+		assert.Equal(t, dn, binds[1].dn)
+	}
+	_, err = ls.GetPeople("doe")
+	assert.NoError(t, err)
+	assert.Len(t, dir.callsOf("bind"), 2)
+
+	// a user with the same dn always binds
+	_, err = ls.Authenticate("doe", "bad")
+	assert.ErrorIs(t, err, ErrLogin)
+	_, err = ls.Authenticate("doe", "bad")
+	assert.ErrorIs(t, err, ErrLogin)
+	assert.Len(t, dir.callsOf("bind"), 4)
+
+	_, err = ls.GetPeople("doe")
+	assert.NoError(t, err)
+	assert.Len(t, dir.callsOf("bind"), 4)
+	assert.Equal(t, 2, dir.dials)
+
+	stats := ls.ap.Stats()
+	assert.Equal(t, uint32(1), stats.TotalConns)
+	assert.Equal(t, uint32(1), ls.cp.Stats().TotalConns)
+}
+
+func TestBindResetFail(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.addPeople("doe", "secret")
+	ls := dir.newSource()
+	defer ls.Close()
+	ls.ap = nil // users bind in the main pool
+	ls.Passwd = "changed"
+
+	_, err := ls.Authenticate("doe", "secret")
+	assert.NoError(t, err)
+	assert.Zero(t, ls.cp.Len(), "removed from pool")
+
+	_, err = ls.Authenticate("doe", "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, dir.dials)
+}
+
+func TestRetryNetworkError(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.addPeople("doe", "secret")
+	ls := dir.newSource()
+	defer ls.Close()
+
+	_, err := ls.GetPeople("doe")
+	assert.NoError(t, err)
+	dir.breakConns()
+
+	_, err = ls.GetPeople("doe")
+	assert.NoError(t, err, "retry on a new connection")
+	assert.Equal(t, 2, dir.dials)
+	assert.Equal(t, 1, ls.cp.Len(), "broken one removed")
+
+	dir.breakConns()
+	ls.cp.Close()
+	ls.cp = pool.NewPool(&pool.Options{
+		Factory: func() (ldap.Client, error) {
+			c, err := dir.dial()
+			c.(*fakeClient).broken = true
+			return c, err
+		},
+		PoolSize:    1,
+		PoolTimeout: time.Second,
+	})
+	_, err = ls.GetPeople("doe")
+	assert.True(t, isNetworkError(err), "retry only once")
+	assert.Equal(t, 4, dir.dials)
+	assert.Zero(t, ls.cp.Len())
+}
+
+func TestNoRetryAfterWrite(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	ls := dir.newSource()
+	defer ls.Close()
+
+	_, err := ls.GetPeople("doe")
+	assert.NoError(t, err)
+	dir.breakConns()
+
+	mr := ldap.NewModifyRequest(dn, nil)
+	mr.Replace("title", []string{"boss"})
+	err = ls.opWithMan(func(c ldap.Client) error {
+		return c.Modify(mr)
+	})
+	assert.True(t, isNetworkError(err), "a write might have been applied")
+	assert.Len(t, dir.callsOf("modify"), 1)
+	assert.Equal(t, 1, dir.dials)
+	assert.Zero(t, ls.cp.Len(), "broken one removed")
+
+	// failed on the bind, before the write
+	_, err = ls.Authenticate("doe", "secret")
+	assert.NoError(t, err)
+	dir.breakConns()
+	err = ls.PasswordChange("doe", "secret", "secret2")
+	assert.NoError(t, err)
+	assert.Len(t, dir.callsOf("passwd"), 1)
+	_, err = ls.Authenticate("doe", "secret2")
+	assert.NoError(t, err)
+}
+
+func TestHealthCheck(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.addPeople("doe", "secret")
+	ls := dir.newSource()
+	defer ls.Close()
+	ls.cp.Close()
+	ls.cp = pool.NewPool(&pool.Options{
+		Factory:     dir.dial,
+		PoolSize:    1,
+		PoolTimeout: time.Second,
+		HealthCheck: ping,
+	})
+
+	_, err := ls.GetPeople("doe")
+	assert.NoError(t, err)
+	dir.breakConns()
+
+	_, err = ls.GetPeople("doe")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, dir.dials)
+	stats := ls.cp.Stats()
+	assert.Equal(t, uint32(1), stats.DeadConns, "evicted before handed out")
+	assert.Equal(t, uint32(2), stats.Misses)
+
+	// checked recently
+	ls.cp.Close()
+	ls.cp = pool.NewPool(&pool.Options{
+		Factory:         dir.dial,
+		PoolSize:        1,
+		PoolTimeout:     time.Second,
+		HealthCheck:     ping,
+		HealthCheckIdle: time.Hour,
+	})
+	_, err = ls.GetPeople("doe")
+	assert.NoError(t, err)
+	n := len(dir.callsOf("search"))
+	_, err = ls.GetPeople("doe")
+	assert.NoError(t, err)
+	assert.Len(t, dir.callsOf("search"), n+1, "no ping")
+}
+
+func TestKeepAlive(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.addPeople("doe", "secret")
+	ls := dir.newSource()
+	defer ls.Close()
+	ls.cp.Close()
+	ls.cp = pool.NewPool(&pool.Options{
+		Factory:           dir.dial,
+		PoolSize:          1,
+		PoolTimeout:       time.Second,
+		HealthCheck:       ping,
+		HealthCheckIdle:   time.Hour,
+		KeepAliveInterval: 10 * time.Millisecond,
+	})
+
+	_, err := ls.GetPeople("doe")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return len(dir.callsOf("search")) > 2
+	}, time.Second, 5*time.Millisecond, "probed in background")
+	assert.Equal(t, 1, ls.cp.IdleLen())
+
+	dir.breakConns()
+	assert.Eventually(t, func() bool {
+		return ls.cp.Stats().DeadConns == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Zero(t, ls.cp.Len())
+}
+
+func TestStoreBreaker(t *testing.T) {
+	down := newFakeDirectory()
+	down.addPeople("doe", "secret")
+	down.dialErr = errors.New("connection refused")
+	up := newFakeDirectory()
+	up.addPeople("doe", "secret")
+
+	bad, good := down.newSource(), up.newSource()
+	bad.Addr = "ldap://down"
+	s := &Store{sources: []*ldapSource{bad, good}}
+	defer s.Close()
+
+	staff, err := s.Get("doe")
+	assert.NoError(t, err)
+	assert.Equal(t, "doe", staff.UID)
+	assert.Equal(t, 1, down.dials)
+	assert.Equal(t, pool.StateOpen, bad.cb.State())
+
+	// route around the open host
+	_, err = s.Get("doe")
+	assert.NoError(t, err)
+	_, err = s.Authenticate("doe", "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, down.dials)
+	assert.Equal(t, []*ldapSource{good}, s.available())
+
+	_, err = bad.GetPeople("doe")
+	assert.ErrorIs(t, err, pool.ErrBreakerOpen)
+	assert.Equal(t, 1, down.dials)
+
+	// a write skips no host, refused before any is written
+	staff.Nickname = "Doe"
+	_, err = s.Save(staff)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorIs(t, err, pool.ErrBreakerOpen)
+	var oe *OpError
+	if assert.ErrorAs(t, err, &oe) {
+		assert.Equal(t, "ldap://down", oe.Addr)
+		assert.Equal(t, OpSave, oe.Op)
+	}
+	assert.Empty(t, up.callsOf("modify"))
+	assert.Empty(t, up.attr(etPeople.DN("doe", fakeBase), "displayName"))
+	assert.ErrorIs(t, s.Delete("doe"), ErrUnavailable)
+	assert.ErrorIs(t, s.PasswordReset("doe", "secret2"), ErrUnavailable)
+	assert.Empty(t, up.callsOf("del"))
+	assert.Empty(t, up.callsOf("passwd"))
+	assert.Equal(t, 1, down.dials)
+
+	health := s.Health()
+	if assert.Len(t, health, 2) {
+		assert.Equal(t, "ldap://down", health[0].Addr)
+		assert.Equal(t, pool.StateOpen, health[0].Breaker.State)
+		assert.Equal(t, "connection refused", health[0].Breaker.LastError)
+		assert.False(t, health[0].Breaker.RetryAt.IsZero())
+		assert.Equal(t, pool.StateClosed, health[1].Breaker.State)
+	}
+
+	// all hosts open, try all
+	good.cb.Failure(errors.New("timeout"))
+	assert.Len(t, s.available(), 2)
+}
+
+func TestListDates(t *testing.T) {
+	dir := newFakeDirectory()
+	ls := dir.newSource()
+	defer ls.Close()
+
+	for uid, dates := range map[string][2]Date{
+		"ann": {"19870526", "20150301"},
+		"bob": {"1990-05-01", "2020-07-01"},
+		"cat": {"19900630", ""},
+		"dan": {"", "20210101"},
+	} {
+		_, err := ls.savePeople(&People{UID: uid, Surname: uid, Birthday: dates[0], JoinDate: dates[1]})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, "19900501", dir.attr(ls.UDN("bob"), "dateOfBirth"), "stored as YYYYMMDD")
+	staff, err := ls.GetPeople("dan")
+	if assert.NoError(t, err) {
+		assert.Equal(t, Date("20210101"), staff.JoinDate)
+		staff.JoinDate = "2021-02-01"
+		_, err = ls.savePeople(staff)
+		assert.NoError(t, err)
+		assert.Equal(t, "20210201", dir.attr(ls.UDN("dan"), "dateOfJoin"), "modified")
+	}
+
+	uids := func(data Peoples) (out []string) {
+		for _, u := range data {
+			out = append(out, u.UID)
+		}
+		sort.Strings(out)
+		return
+	}
+	cases := []struct {
+		spec *Spec
+		want []string
+	}{
+		{&Spec{BirthMonth: time.May}, []string{"ann", "bob"}},
+		{&Spec{BirthMonth: time.June}, []string{"cat"}},
+		{&Spec{Birthday: &model.DateRange{From: "1990-01-01"}}, []string{"bob", "cat"}},
+		{&Spec{Birthday: &model.DateRange{From: "1990-01-01", To: "1990-05-31"}, BirthMonth: time.May}, []string{"bob"}},
+		{&Spec{JoinDate: &model.DateRange{To: "2020-12-31"}}, []string{"ann", "bob"}},
+		{&Spec{UIDs: []string{"dan"}, JoinDate: &model.DateRange{From: "2021-01-01"}}, []string{"dan"}},
+	}
+	for i, c := range cases {
+		assert.Equal(t, c.want, uids(ls.List(c.spec)), i)
+	}
+	// sealed, matched after opened
+	ls.sealer = newFakeSealer(t, "k1")
+	ls.sealed = []string{"dateOfBirth"}
+	_, err = ls.savePeople(&People{UID: "eve", Surname: "eve", Birthday: "1991-05-20"})
+	assert.NoError(t, err)
+	assert.Empty(t, dir.attr(ls.UDN("eve"), "dateOfBirth"))
+	assert.Equal(t, []string{"eve"}, uids(ls.List(&Spec{BirthMonth: time.May, Birthday: &model.DateRange{From: "19910101"}})))
+}
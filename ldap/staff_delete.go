@@ -2,13 +2,22 @@ package ldap
 
 import (
 	"github.com/go-ldap/ldap/v3"
+
+	"github.com/liut/staffio-backend/audit"
 )
 
 // Delete ...
 func (s *Store) Delete(uid string) (err error) {
-	for _, ls := range s.sources {
+	before := s.auditGet(uid)
+	defer func() { s.emitPeople(audit.ActionDelete, uid, before, nil, err) }()
+	sources, err := s.writable(OpDelete)
+	if err != nil {
+		return
+	}
+	for _, ls := range sources {
 		err = ls.DeletePeople(uid)
 		if err != nil {
+			err = ls.opError(OpDelete, ls.UDN(uid), err)
 			return
 		}
 	}
@@ -2,37 +2,132 @@ package ldap
 
 import (
 	"github.com/go-ldap/ldap/v3"
+
+	"github.com/liut/staffio-backend/audit"
 )
 
-// ModifyBySelf ...
+// ModifyBySelf changes fields of People by self, fields allowed for RoleSelf by FieldPolicy
 func (s *Store) ModifyBySelf(uid, password string, staff *People) (err error) {
-	for _, ls := range s.sources {
-		err = ls.Modify(uid, password, staff)
+	before := s.auditGet(uid)
+	defer func() { s.emitPeople(audit.ActionModifyBySelf, uid, before, staff, err) }()
+	var errs []error
+	sources, err := s.writable(OpModify)
+	if err != nil {
+		return
+	}
+	for _, ls := range sources {
+		err = ls.modify(RoleSelf, uid, password, staff, s.validate)
 		if err != nil {
 			logger().Infow("Modify by self fail", "uid", uid, "err", err)
+			errs = append(errs, ls.opError(OpModify, ls.UDN(uid), err))
+		}
+	}
+	err = multiError(errs)
+	return
+}
+
+// ModifyAs changes fields of People of uid by role with the service account,
+// a change of fields not allowed for role by FieldPolicy is a *FieldAccessError
+func (s *Store) ModifyAs(role Role, uid string, staff *People) (err error) {
+	before := s.auditGet(uid)
+	defer func() { s.emitPeople(audit.ActionModify, uid, before, staff, err) }()
+	var errs []error
+	sources, err := s.writable(OpModify)
+	if err != nil {
+		return
+	}
+	for _, ls := range sources {
+		err = ls.modify(role, uid, "", staff, s.validate)
+		if err != nil {
+			logger().Infow("Modify as role fail", "role", role, "uid", uid, "err", err)
+			errs = append(errs, ls.opError(OpModify, ls.UDN(uid), err))
 		}
 	}
+	err = multiError(errs)
 	return
 }
 
-func (ls *ldapSource) Modify(uid, password string, staff *People) error {
+// modify changes fields of People by role, binds as uid with password for RoleSelf,
+// check validates the changed fields of People as modified before any change is sent
+func (ls *ldapSource) modify(role Role, uid, password string, staff *People, check func(*People, ...string) error) error {
 
-	logger().Debugw("modify start", "uid", uid, "staff", staff)
+	logger().Debugw("modify start", "uid", uid, "role", role, "staff", staff)
 
 	userdn := ls.UDN(uid)
-	return ls.opWithDN(userdn, password, func(c ldap.Client) (err error) {
+	binddn := userdn
+	if role != RoleSelf {
+		binddn, password = ls.BindDN, ls.Passwd
+	}
+	useAssert := staff.Version != "" && ls.useAssertion()
+	ls, span := ls.trace(SpanModify, Attr{AttrBase, userdn})
+	err := ls.opWithDN(binddn, password, func(c ldap.Client) (err error) {
 		entry, err := ldapFindOne(c, userdn, etPeople.Filter, etPeople.Attributes...)
 		if err != nil {
 			return err
 		}
 
 		modify := makeModifyRequest(entry, staff)
+		if err = ls.dropUnchanged(modify, entry); err != nil {
+			return err
+		}
+		if fields := changedFields(modify); check != nil && len(fields) > 0 {
+			if err = check(modifiedPeople(ls.toPeople(entry), staff), fields...); err != nil {
+				return err
+			}
+		}
+		if err = ls.fieldPolicy().Check(role, changedFields(modify)...); err != nil {
+			logger().Infow("modify rejected", "dn", userdn, "err", err)
+			return err
+		}
+		if modify.Controls, err = expectVersion(entry, staff.Version, useAssert); err != nil {
+			return err
+		}
+		if err = ls.sealModify(modify, entry, wantOf(staff)); err != nil {
+			return err
+		}
 
-		if err = c.Modify(modify); err != nil {
+		if err = versionError(c.Modify(modify)); err != nil {
 			logger().Infow("modify fail", "dn", userdn, "err", err)
+			return err
 		}
 		logger().Debugw("modified ok", "dn", userdn)
 		return nil
 	})
+	endSpan(span, err)
+	return err
+}
 
+// modifiedPeople returns cur with the fields of staff written by makeModifyRequest
+func modifiedPeople(cur, staff *People) *People {
+	p := *cur
+	p.Surname, p.GivenName, p.CommonName = staff.Surname, staff.GivenName, staff.GetCommonName()
+	for dst, src := range map[*string]string{
+		&p.Nickname:       staff.Nickname,
+		&p.Email:          staff.Email,
+		&p.Mobile:         staff.Mobile,
+		&p.AvatarPath:     staff.AvatarPath,
+		&p.Gender:         staff.Gender,
+		&p.Description:    staff.Description,
+		&p.EmployeeNumber: staff.EmployeeNumber,
+		&p.EmployeeType:   staff.EmployeeType,
+		&p.IDCN:           staff.IDCN,
+	} {
+		if src != "" {
+			*dst = src
+		}
+	}
+	if !staff.Birthday.IsZero() {
+		p.Birthday = staff.Birthday
+	}
+	if !staff.JoinDate.IsZero() {
+		p.JoinDate = staff.JoinDate
+	}
+	return &p
+}
+
+func (ls *ldapSource) fieldPolicy() FieldPolicy {
+	if ls.fields == nil {
+		return DefaultFieldPolicy
+	}
+	return ls.fields
 }
@@ -1,59 +1,228 @@
 package ldap
 
 import (
+	"fmt"
+	"sync/atomic"
+
 	"github.com/go-ldap/ldap/v3"
+
+	"github.com/liut/staffio-backend/audit"
+	"github.com/liut/staffio-backend/passwd"
+)
+
+const (
+	oidPasswordModify = "1.3.6.1.4.1.4203.1.11.1"
 )
 
-// PasswordChange ...
+// PasswordChange verifies oldPasswd by a bind before the new one is checked with PasswordPolicy,
+// so that a caller not authenticated gets ErrLogin only, never a violation of the policy
 func (s *Store) PasswordChange(uid, oldPasswd, newPasswd string) (err error) {
-	for _, ls := range s.sources {
+	defer func() { s.emit(audit.ActionPasswordChange, uid, passwordChanges(), err) }()
+	sources, err := s.writable(OpPassword)
+	if err != nil {
+		return
+	}
+	staff, _, err := sources[0].AuthenticateWithPolicy(uid, oldPasswd)
+	if err != nil {
+		logger().Infow("password change refused, old password not verified", "uid", uid, "err", err)
+		err = sources[0].opError(OpPassword, sources[0].UDN(uid), err)
+		return
+	}
+	if err = s.checkPasswordOf(staff, newPasswd); err != nil {
+		return
+	}
+	for _, ls := range sources {
 		err = ls.PasswordChange(uid, oldPasswd, newPasswd)
 		if err != nil {
+			err = ls.opError(OpPassword, ls.UDN(uid), err)
 			break
 		}
 	}
+	if err == nil {
+		s.rememberPassword(uid, newPasswd)
+	}
 	return
 }
 
+// PasswordChange bind as the user with old password and change it,
+// a wrong old password is ErrLogin, a rejection by the server is ErrPasswordRejected
 func (ls *ldapSource) PasswordChange(uid, oldPasswd, newPasswd string) error {
 	userdn := ls.UDN(uid)
-	c, err := ls.cp.Get()
-	defer ls.cp.Put(c)
-	if err == nil {
-		pmr := ldap.NewPasswordModifyRequest(userdn, oldPasswd, newPasswd)
-		_, err := c.PasswordModify(pmr)
+	useExt := ls.usePasswordModify()
+	err := ls.opWithDN(userdn, oldPasswd, func(c ldap.Client) (err error) {
+		if useExt {
+			pmr := ldap.NewPasswordModifyRequest(userdn, oldPasswd, newPasswd)
+			_, err = c.PasswordModify(pmr)
+		} else {
+			err = ls.modifyPassword(c, userdn, newPasswd)
+		}
 		if err != nil {
 			logger().Infow("PasswordModify fail", "uid", uid, "err", err)
-			return err
+			return passwordError(err)
 		}
 		logger().Infow("PasswordModify OK", "uid", uid)
+		return nil
+	})
+	if ldap.IsErrorAnyOf(err, ldap.LDAPResultInvalidCredentials, ldap.LDAPResultInvalidDNSyntax) {
+		return ErrLogin
 	}
-
 	return err
 }
 
 // PasswordReset ...
-func (s *Store) PasswordReset(uid, passwd string) (err error) {
-	for _, ls := range s.sources {
-		err = ls.PasswordReset(uid, passwd)
+func (s *Store) PasswordReset(uid, newPasswd string) (err error) {
+	defer func() { s.emit(audit.ActionPasswordReset, uid, passwordChanges(), err) }()
+	if err = s.checkPassword(uid, newPasswd); err != nil {
+		return
+	}
+	sources, err := s.writable(OpPassword)
+	if err != nil {
+		return
+	}
+	for _, ls := range sources {
+		err = ls.PasswordReset(uid, newPasswd)
 		if err != nil {
+			err = ls.opError(OpPassword, ls.UDN(uid), err)
 			break
 		}
 	}
+	if err == nil {
+		s.rememberPassword(uid, newPasswd)
+	}
 	return
 }
 
+// checkPassword checks new password with PasswordPolicy, return *passwd.ViolationError if rejected
+func (s *Store) checkPassword(uid, newPasswd string) error {
+	if s.pwdPolicy == nil {
+		return nil
+	}
+	staff, err := s.Get(uid)
+	if err != nil {
+		return err
+	}
+	return s.checkPasswordOf(staff, newPasswd)
+}
+
+func (s *Store) checkPasswordOf(staff *People, newPasswd string) error {
+	if s.pwdPolicy == nil {
+		return nil
+	}
+	err := s.pwdPolicy.Check(staff, newPasswd)
+	if err != nil {
+		logger().Infow("password rejected by policy", "uid", staff.UID, "err", err)
+	}
+	return err
+}
+
+func (s *Store) rememberPassword(uid, newPasswd string) {
+	if s.pwdPolicy == nil {
+		return
+	}
+	if err := s.pwdPolicy.Remember(uid, newPasswd); err != nil {
+		logger().Infow("remember password fail", "uid", uid, "err", err)
+	}
+}
+
 // password reset by administrator
 func (ls *ldapSource) PasswordReset(uid, newPasswd string) error {
 	dn := ls.UDN(uid)
-	return ls.opWithMan(func(c ldap.Client) error {
-		passwordModifyRequest := ldap.NewPasswordModifyRequest(dn, "", newPasswd)
-		_, err := c.PasswordModify(passwordModifyRequest)
+	useExt := ls.usePasswordModify()
+	return ls.opWithMan(func(c ldap.Client) (err error) {
+		if useExt {
+			passwordModifyRequest := ldap.NewPasswordModifyRequest(dn, "", newPasswd)
+			_, err = c.PasswordModify(passwordModifyRequest)
+		} else {
+			err = ls.modifyPassword(c, dn, newPasswd)
+		}
 		if err != nil {
 			logger().Infow("PasswordReset fail", "uid", uid, "err", err)
-			return err
+			return passwordError(err)
 		}
 		logger().Infow("PasswordModify OK", "uid", uid)
 		return nil
 	})
 }
+
+// passwordError wraps a rejection of the server with ErrPasswordRejected
+func passwordError(err error) error {
+	if ldap.IsErrorAnyOf(err, ldap.LDAPResultConstraintViolation, ldap.LDAPResultUnwillingToPerform) {
+		return fmt.Errorf("%w: %w", ErrPasswordRejected, err)
+	}
+	return err
+}
+
+// modifyPassword hash password in client and replace userPassword
+func (ls *ldapSource) modifyPassword(c ldap.Client, dn, newPasswd string) error {
+	hashed, err := passwd.Hash(ls.pwdScheme, newPasswd)
+	if err != nil {
+		return err
+	}
+	mr := ldap.NewModifyRequest(dn, nil)
+	mr.Replace("userPassword", []string{hashed})
+	return c.Modify(mr)
+}
+
+// usePasswordModify reports whether the Password Modify extended operation is used
+func (ls *ldapSource) usePasswordModify() bool {
+	switch ls.pwdMode {
+	case PasswordModeExtended:
+		return true
+	case PasswordModeHash:
+		return false
+	}
+	switch atomic.LoadInt32(ls.pwdExt) {
+	case 1:
+		return true
+	case 2:
+		return false
+	}
+
+	ok, err := ls.supported("supportedExtension", oidPasswordModify)
+	if err != nil {
+		logger().Infow("detect Password Modify fail", "addr", ls.Addr, "err", err)
+		return true
+	}
+	if ok {
+		atomic.StoreInt32(ls.pwdExt, 1)
+	} else {
+		logger().Infow("Password Modify unsupported, hash password in client", "addr", ls.Addr, "scheme", ls.pwdScheme)
+		atomic.StoreInt32(ls.pwdExt, 2)
+	}
+	return ok
+}
+
+// supported reports whether oid is in attr of root DSE, such as supportedExtension and supportedControl
+func (ls *ldapSource) supported(attr, oid string) (ok bool, err error) {
+	err = ls.opWithMan(func(c ldap.Client) error {
+		entry, err := ldapRootDSE(c, attr)
+		if err != nil {
+			return err
+		}
+		for _, v := range entry.GetAttributeValues(attr) {
+			if v == oid {
+				ok = true
+				break
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func ldapRootDSE(c ldap.Client, attrs ...string) (*ldap.Entry, error) {
+	search := ldap.NewSearchRequest(
+		"",
+		ldap.ScopeBaseObject, ldap.NeverDerefAliases, 0, 0, false,
+		"(objectClass=*)",
+		attrs,
+		nil)
+	sr, err := c.Search(search)
+	if err != nil {
+		return nil, err
+	}
+	if len(sr.Entries) == 0 {
+		return nil, ErrNotFound
+	}
+	return sr.Entries[0], nil
+}
@@ -0,0 +1,175 @@
+package ldap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio-backend/passwd"
+)
+
+func TestPasswordModeDetect(t *testing.T) {
+	dir := newFakeDirectory()
+	ls := dir.newSource()
+	defer ls.Close()
+	assert.True(t, ls.usePasswordModify())
+	assert.Len(t, dir.callsOf("search"), 1)
+	assert.True(t, ls.usePasswordModify())
+	assert.Len(t, dir.callsOf("search"), 1, "detected once")
+
+	dir.extensions = nil
+	ls2 := dir.newSource()
+	defer ls2.Close()
+	assert.False(t, ls2.usePasswordModify())
+
+	ls2.pwdMode = PasswordModeExtended
+	assert.True(t, ls2.usePasswordModify())
+	ls.pwdMode = PasswordModeHash
+	assert.False(t, ls.usePasswordModify())
+}
+
+func TestPasswordHashFallback(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.extensions = nil
+	dn := dir.addPeople("doe", "secret")
+	ls := dir.newSource()
+	ls.pwdScheme = passwd.SchemeSSHA512
+	defer ls.Close()
+
+	err := ls.PasswordReset("doe", "secret2")
+	assert.NoError(t, err)
+	assert.Empty(t, dir.callsOf("passwd"))
+	hashed := dir.attr(dn, "userPassword")
+	assert.True(t, strings.HasPrefix(hashed, passwd.SchemeSSHA512), hashed)
+
+	_, err = ls.Authenticate("doe", "secret")
+	assert.ErrorIs(t, err, ErrLogin)
+	staff, err := ls.Authenticate("doe", "secret2")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "doe", staff.UID)
+	}
+
+	err = ls.PasswordChange("doe", "bad", "secret3")
+	assert.Error(t, err)
+	err = ls.PasswordChange("doe", "secret2", "secret3")
+	assert.NoError(t, err)
+	_, err = ls.Authenticate("doe", "secret3")
+	assert.NoError(t, err)
+	for _, c := range dir.callsOf("modify") {
+		assert.NotContains(t, dir.attr(c.dn, "userPassword"), "secret")
+	}
+
+	ls.pwdScheme = "{MD5}"
+	err = ls.PasswordReset("doe", "secret4")
+	assert.Equal(t, passwd.ErrUnsupportedScheme, err)
+}
+
+func TestPasswordExtended(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	ls := dir.newSource()
+	defer ls.Close()
+
+	err := ls.PasswordReset("doe", "secret2")
+	assert.NoError(t, err)
+	if calls := dir.callsOf("passwd"); assert.Len(t, calls, 1) {
+		assert.Equal(t, dn, calls[0].dn)
+		assert.Equal(t, fakeAdminDN, calls[0].by)
+	}
+	_, err = ls.Authenticate("doe", "secret2")
+	assert.NoError(t, err)
+}
+
+func TestPasswordChangeIdentity(t *testing.T) {
+	dir := newFakeDirectory()
+	dn := dir.addPeople("doe", "secret")
+	dn2 := dir.addPeople("cat", "meow")
+	// a single connection of each pool, reused by binds of different identities
+	dir.poolSize = 1
+	ls := dir.newSource()
+	defer ls.Close()
+
+	// the service connection is bound as admin first
+	_, err := ls.GetPeople("cat")
+	assert.NoError(t, err)
+
+	err = ls.PasswordChange("doe", "secret", "secret2")
+	assert.NoError(t, err)
+	if calls := dir.callsOf("passwd"); assert.Len(t, calls, 1) {
+		assert.Equal(t, dn, calls[0].by)
+	}
+	assert.Equal(t, 2, dir.dials, "one connection per pool")
+
+	// the auth connection was left bound as doe
+	err = ls.PasswordChange("cat", "bad", "meow2")
+	assert.ErrorIs(t, err, ErrLogin)
+	assert.Len(t, dir.callsOf("passwd"), 1, "no modify without bind")
+
+	err = ls.PasswordChange("cat", "meow", "meow2")
+	assert.NoError(t, err)
+	if calls := dir.callsOf("passwd"); assert.Len(t, calls, 2) {
+		assert.Equal(t, dn2, calls[1].by)
+	}
+
+	// admin operation after user binds
+	err = ls.PasswordReset("doe", "secret3")
+	assert.NoError(t, err)
+	if calls := dir.callsOf("passwd"); assert.Len(t, calls, 3) {
+		assert.Equal(t, fakeAdminDN, calls[2].by)
+	}
+
+	_, err = ls.Authenticate("doe", "secret3")
+	assert.NoError(t, err)
+	_, err = ls.Authenticate("cat", "meow2")
+	assert.NoError(t, err)
+}
+
+func TestPasswordChangeErrors(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.addPeople("doe", "secret")
+	ls := dir.newSource()
+	defer ls.Close()
+
+	err := ls.PasswordChange("doe", "", "secret2")
+	assert.Equal(t, ErrEmptyPwd, err)
+
+	err = ls.PasswordChange("nobody", "secret", "secret2")
+	assert.ErrorIs(t, err, ErrLogin)
+
+	err = ls.PasswordChange("doe", "secret", "s")
+	assert.ErrorIs(t, err, ErrPasswordRejected)
+	assert.NotErrorIs(t, err, ErrLogin)
+	assert.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultConstraintViolation))
+
+	err = ls.PasswordReset("doe", "s")
+	assert.ErrorIs(t, err, ErrPasswordRejected)
+}
+
+func TestPasswordChangePolicy(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.addPeople("doe", "secret1")
+	s := &Store{sources: []*ldapSource{dir.newSource()}}
+	defer s.Close()
+	s.pwdPolicy = &passwd.Policy{HistorySize: 3, History: passwd.NewMemoryHistory()}
+
+	assert.NoError(t, s.PasswordReset("doe", "secret1"))
+	assert.NoError(t, s.PasswordChange("doe", "secret1", "secret2"))
+
+	// no violation told before the old password is verified
+	for _, guess := range []string{"secret1", "secret2", "secret9"} {
+		err := s.PasswordChange("doe", "wrong", guess)
+		assert.ErrorIs(t, err, ErrLogin, guess)
+		assert.NotErrorIs(t, err, passwd.ErrPolicyViolation, guess)
+	}
+	assert.Len(t, dir.callsOf("passwd"), 2)
+
+	err := s.PasswordChange("doe", "secret2", "secret1")
+	assert.ErrorIs(t, err, passwd.ErrPolicyViolation)
+	var ve *passwd.ViolationError
+	if assert.ErrorAs(t, err, &ve) {
+		assert.True(t, ve.Has(passwd.RuleHistory))
+	}
+	assert.NoError(t, s.PasswordChange("doe", "secret2", "secret3"))
+}
@@ -1,28 +1,34 @@
 package ldap
 
 import (
+	"strings"
 	"time"
 
 	"github.com/go-ldap/ldap/v3"
+
+	"github.com/liut/staffio-backend/model"
 )
 
 func (ls *ldapSource) savePeople(staff *People) (isNew bool, err error) {
+	useAssert := staff.Version != "" && ls.useAssertion()
 	err = ls.opWithMan(func(c ldap.Client) (err error) {
 		var entry *ldap.Entry
 		entry, err = ldapFindOne(c, ls.Base, etPeople.oneFilter(staff.UID), etPeople.Attributes...)
 		if err == nil {
 			// :update
 			mr := makeModifyRequest(entry, staff)
-			eidStr := staff.EmployeeNumber
-			if len(staff.EmployeeNumber) > 0 && eidStr != entry.GetAttributeValue("employeeNumber") {
-				mr.Replace("employeeNumber", []string{eidStr})
+			if mr.Controls, err = expectVersion(entry, staff.Version, useAssert); err != nil {
+				return
+			}
+			if missing := missingClasses(entry); len(missing) > 0 {
+				mr.Add("objectClass", missing)
 			}
-			if len(staff.EmployeeType) > 0 && staff.EmployeeType != entry.GetAttributeValue("employeeType") {
-				mr.Replace("employeeType", []string{staff.EmployeeType})
+			if err = ls.sealModify(mr, entry, wantOf(staff)); err != nil {
+				return
 			}
-			err = c.Modify(mr)
+			err = versionError(c.Modify(mr))
 			if err != nil {
-				logger().Infow("modify fail", "mr", mr, "err", err)
+				logger().Infow("modify fail", "dn", mr.DN, "err", err)
 			}
 			return
 		}
@@ -30,6 +36,9 @@ func (ls *ldapSource) savePeople(staff *People) (isNew bool, err error) {
 			dn := ls.UDN(staff.UID)
 			isNew = true
 			ar := makeAddRequest(dn, staff)
+			if err = ls.sealAdd(ar, staff); err != nil {
+				return
+			}
 			err = c.Add(ar)
 			if err != nil {
 				logger().Infow("add fail", "isAD", ls.isAD, "dn", dn, "staff", staff, "err", err)
@@ -74,10 +83,10 @@ func makeAddRequest(dn string, staff *People) *ldap.AddRequest {
 		ar.Attribute("employeeType", []string{staff.EmployeeType})
 	}
 	if staff.Gender != "" {
-		ar.Attribute("gender", []string{staff.Gender[0:1]})
+		ar.Attribute("gender", []string{model.Initial(staff.Gender)})
 	}
 	if staff.Birthday != "" {
-		ar.Attribute("dateOfBirth", []string{staff.Birthday})
+		ar.Attribute("dateOfBirth", []string{staff.Birthday.LDAP()})
 	}
 	if staff.Description != "" {
 		ar.Attribute("description", []string{staff.Description})
@@ -86,10 +95,13 @@ func makeAddRequest(dn string, staff *People) *ldap.AddRequest {
 		ar.Attribute("avatarPath", []string{staff.AvatarPath})
 	}
 	if staff.JoinDate != "" {
-		ar.Attribute("dateOfJoin", []string{staff.JoinDate})
+		ar.Attribute("dateOfJoin", []string{staff.JoinDate.LDAP()})
+	}
+	if staff.IDCN != "" {
+		ar.Attribute("idcnNumber", []string{staff.IDCN})
 	}
 	if staff.Created != nil {
-		ar.Attribute("createdTime", []string{staff.Created.Format(TimeLayout)})
+		ar.Attribute("createdTime", []string{FormatGeneralizedTime(*staff.Created)})
 	}
 
 	// if staff.Passwd != "" {
@@ -99,9 +111,26 @@ func makeAddRequest(dn string, staff *People) *ldap.AddRequest {
 	return ar
 }
 
+// missingClasses returns classes of objectClassPeople which entry lacks, such as one created by others
+func missingClasses(entry *ldap.Entry) (missing []string) {
+	classes := entry.GetAttributeValues("objectClass")
+	for _, oc := range objectClassPeople {
+		found := false
+		for _, c := range classes {
+			if strings.EqualFold(c, oc) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, oc)
+		}
+	}
+	return
+}
+
 func makeModifyRequest(entry *ldap.Entry, staff *People) *ldap.ModifyRequest {
 	mr := ldap.NewModifyRequest(entry.DN, nil)
-	mr.Replace("objectClass", objectClassPeople)
 	if staff.Surname != entry.GetAttributeValue("sn") {
 		mr.Replace("sn", []string{staff.Surname})
 	}
@@ -123,20 +152,32 @@ func makeModifyRequest(entry *ldap.Entry, staff *People) *ldap.ModifyRequest {
 	if len(staff.AvatarPath) > 0 && staff.AvatarPath != entry.GetAttributeValue("avatarPath") {
 		mr.Replace("avatarPath", []string{staff.AvatarPath})
 	}
-	if staff.Gender != "" {
-		mr.Replace("gender", []string{staff.Gender[0:1]})
+	if gender := model.Initial(staff.Gender); gender != "" && gender != entry.GetAttributeValue("gender") {
+		mr.Replace("gender", []string{gender})
 	}
-	if len(staff.Birthday) > 0 && staff.Birthday != entry.GetAttributeValue("dateOfBirth") {
-		mr.Replace("dateOfBirth", []string{staff.Birthday})
+	if birthday := staff.Birthday.LDAP(); len(birthday) > 0 && birthday != entry.GetAttributeValue("dateOfBirth") {
+		mr.Replace("dateOfBirth", []string{birthday})
+	}
+	if joinDate := staff.JoinDate.LDAP(); len(joinDate) > 0 && joinDate != entry.GetAttributeValue("dateOfJoin") {
+		mr.Replace("dateOfJoin", []string{joinDate})
 	}
 	if len(staff.Description) > 0 && staff.Description != entry.GetAttributeValue("description") {
 		mr.Replace("description", []string{staff.Description})
 	}
+	if len(staff.EmployeeNumber) > 0 && staff.EmployeeNumber != entry.GetAttributeValue("employeeNumber") {
+		mr.Replace("employeeNumber", []string{staff.EmployeeNumber})
+	}
+	if len(staff.EmployeeType) > 0 && staff.EmployeeType != entry.GetAttributeValue("employeeType") {
+		mr.Replace("employeeType", []string{staff.EmployeeType})
+	}
+	if len(staff.IDCN) > 0 && staff.IDCN != entry.GetAttributeValue("idcnNumber") {
+		mr.Replace("idcnNumber", []string{staff.IDCN})
+	}
 	modified := time.Now()
 	if staff.Modified != nil {
 		modified = *staff.Modified
 	}
-	mr.Replace("modifiedTime", []string{modified.Format(TimeLayout)})
+	mr.Replace("modifiedTime", []string{FormatGeneralizedTime(modified)})
 
 	return mr
 }
@@ -2,12 +2,24 @@ package ldap
 
 import (
 	"strings"
+
+	"github.com/liut/staffio-backend/audit"
+	"github.com/liut/staffio-backend/ldap/pool"
+	"github.com/liut/staffio-backend/model"
+	"github.com/liut/staffio-backend/passwd"
 )
 
 // Store ..
 type Store struct {
 	sources  []*ldapSource
 	pageSize int
+
+	pwdPolicy *passwd.Policy
+	validator *model.Validator
+	photoMax  int
+
+	audit audit.Sink
+	actor string
 }
 
 // NewStore ...
@@ -17,6 +29,12 @@ func NewStore(cfg *Config) (*Store, error) {
 	}
 	store := &Store{
 		pageSize: cfg.PageSize,
+
+		pwdPolicy: cfg.PasswordPolicy,
+		validator: cfg.Validator,
+		photoMax:  cfg.PhotoMaxSize,
+
+		audit: auditSink(cfg.Audit),
 	}
 	for _, addr := range strings.Split(cfg.Addr, ",") {
 		c := &Config{
@@ -25,6 +43,20 @@ func NewStore(cfg *Config) (*Store, error) {
 			Bind:   cfg.Bind,
 			Passwd: cfg.Passwd,
 			Domain: cfg.Domain,
+
+			AuthPoolSize:    cfg.AuthPoolSize,
+			HealthCheckIdle: cfg.HealthCheckIdle,
+			KeepAlive:       cfg.KeepAlive,
+			Breaker:         cfg.Breaker,
+			Observer:        cfg.Observer,
+			Tracer:          cfg.Tracer,
+			PasswordMode:    cfg.PasswordMode,
+			PasswordScheme:  cfg.PasswordScheme,
+
+			Sealer:           cfg.Sealer,
+			SealedAttributes: cfg.SealedAttributes,
+			FieldPolicy:      cfg.FieldPolicy,
+			RecordLogins:     cfg.RecordLogins,
 		}
 		ls, err := newSource(c)
 		if err != nil {
@@ -44,40 +76,76 @@ func (s *Store) Close() {
 	}
 }
 
-// Authenticate verify uid and password from one of sources, return valid DN and error
+// Authenticate verify uid and password from one of sources, return valid DN and error,
+// a login with MustChange of the password policy is refused as a *PolicyError of ErrPasswordMustChange
 func (s *Store) Authenticate(uid, passwd string) (staff *People, err error) {
-	for _, ls := range s.sources {
-		staff, err = ls.Authenticate(uid, passwd)
+	staff, pp, err := s.authenticate(uid, passwd)
+	if err != nil {
+		return nil, err
+	}
+	if pp != nil && pp.MustChange {
+		logger().Infow("Authen refused, password must be changed", "uid", uid)
+		return nil, &PolicyError{Policy: pp, Err: ErrPasswordMustChange}
+	}
+	s.recordLogin(staff)
+	return
+}
+
+// AuthenticateWithPolicy like Authenticate, also return state of password policy if the server supports it,
+// a refused login by the policy is a *PolicyError, a login with MustChange succeeds
+// and the caller should only allow PasswordChange
+func (s *Store) AuthenticateWithPolicy(uid, passwd string) (staff *People, pp *PasswordPolicy, err error) {
+	staff, pp, err = s.authenticate(uid, passwd)
+	if err == nil {
+		s.recordLogin(staff)
+	}
+	return
+}
+
+func (s *Store) authenticate(uid, passwd string) (staff *People, pp *PasswordPolicy, err error) {
+	var errs []error
+	for _, ls := range s.available() {
+		staff, pp, err = ls.AuthenticateWithPolicy(uid, passwd)
 		if err == nil {
-			logger().Debugw("authenticate ok", "uid", uid)
+			logger().Debugw("authenticate ok", "uid", uid, "policy", pp)
 			return
 		}
+		errs = append(errs, ls.opError(OpBind, ls.UDN(uid), err))
 	}
+	err = bareError(errs, ErrLogin)
 	logger().Infow("Authen failed", "uid", uid, "err", err)
 	return
 }
 
 // Get return People with uid
 func (s *Store) Get(uid string) (staff *People, err error) {
-	for _, ls := range s.sources {
+	var errs []error
+	for _, ls := range s.available() {
 		staff, err = ls.GetPeople(uid)
 		if err == nil {
 			return
 		}
+		errs = append(errs, ls.opError(OpSearch, ls.UDN(uid), err))
+	}
+	if err = bareError(errs, ErrNotFound); err == nil {
+		err = ErrNotFound
 	}
-	err = ErrNotFound
 	return
 }
 
 // GetByDN ...
 func (s *Store) GetByDN(dn string) (staff *People, err error) {
-	for _, ls := range s.sources {
+	var errs []error
+	for _, ls := range s.available() {
 		staff, err = ls.GetByDN(dn)
 		if err == nil {
 			return
 		}
+		errs = append(errs, ls.opError(OpSearch, dn, err))
+	}
+	if err = bareError(errs, ErrNotFound); err == nil {
+		err = ErrNotFound
 	}
-	err = ErrNotFound
 	return
 }
 
@@ -89,7 +157,7 @@ func (s *Store) All(spec *Spec) (staffs Peoples) {
 	if spec.Limit == 0 {
 		spec.Limit = s.pageSize
 	}
-	for _, ls := range s.sources {
+	for _, ls := range s.available() {
 		staffs = ls.List(spec)
 	}
 	return
@@ -97,16 +165,93 @@ func (s *Store) All(spec *Spec) (staffs Peoples) {
 
 // Save ...
 func (s *Store) Save(staff *People) (isNew bool, err error) {
-	for _, ls := range s.sources {
+	before := s.auditGet(staff.UID)
+	defer func() { s.emitPeople(audit.ActionSave, staff.UID, before, staff, err) }()
+	if err = s.validate(staff); err != nil {
+		return
+	}
+	sources, err := s.writable(OpSave)
+	if err != nil {
+		return
+	}
+	for _, ls := range sources {
 		isNew, err = ls.savePeople(staff)
 		if err != nil {
 			logger().Infow("savePeople fail", "staff", staff, "err", err)
+			err = ls.opError(OpSave, ls.UDN(staff.UID), err)
 			return
 		}
 	}
 	return
 }
 
+// validate checks People with Validator, only fields by JSON name if any, return *model.ValidationError if rejected
+func (s *Store) validate(staff *People, fields ...string) error {
+	v := s.validator
+	if v == nil {
+		v = new(model.Validator)
+	}
+	var err error
+	if len(fields) > 0 {
+		err = v.ValidateFields(staff, fields...)
+	} else {
+		err = v.Validate(staff)
+	}
+	if err != nil {
+		logger().Infow("people rejected by validator", "uid", staff.UID, "err", err)
+	}
+	return err
+}
+
+// available returns sources not refused by circuit breaker, or all if none, for reads and Authenticate
+func (s *Store) available() []*ldapSource {
+	sources := make([]*ldapSource, 0, len(s.sources))
+	for _, ls := range s.sources {
+		if ls.available() {
+			sources = append(sources, ls)
+		}
+	}
+	if len(sources) == 0 {
+		return s.sources
+	}
+	return sources
+}
+
+// writable returns all sources for a write of op, or an unavailable error naming each host
+// refused by circuit breaker, so that a write never skips a replica
+func (s *Store) writable(op string) ([]*ldapSource, error) {
+	var errs []error
+	for _, ls := range s.sources {
+		if !ls.available() {
+			errs = append(errs, ls.opError(op, "", pool.ErrBreakerOpen))
+		}
+	}
+	if err := multiError(errs); err != nil {
+		logger().Infow("write refused", "op", op, "err", err)
+		return nil, err
+	}
+	return s.sources, nil
+}
+
+// SourceHealth health of a LDAP host
+type SourceHealth struct {
+	Addr    string             `json:"addr"`
+	Breaker pool.BreakerStatus `json:"breaker"`
+}
+
+// Health returns state of circuit breaker of each host
+func (s *Store) Health() []SourceHealth {
+	out := make([]SourceHealth, 0, len(s.sources))
+	for _, ls := range s.sources {
+		h := SourceHealth{Addr: ls.Addr}
+		if ls.cb != nil {
+			h.Breaker = ls.cb.Status()
+		}
+		out = append(out, h)
+	}
+	return out
+}
+
 // Ready ...
 func (s *Store) Ready() error {
 	for _, ls := range s.sources {
@@ -118,20 +263,30 @@ func (s *Store) Ready() error {
 	return nil
 }
 
-// PoolStats ...
+// PoolStats stats of the main pool, and the auth pool in Auth
 func (s *Store) PoolStats() *PoolStats {
 	var pss PoolStats
 	for _, ls := range s.sources {
-		s := ls.cp.Stats()
-		pss.Hits += s.Hits
-		pss.Misses += s.Misses
-		pss.Timeouts += s.Timeouts
-		pss.TotalConns += s.TotalConns
-		pss.IdleConns += s.IdleConns
+		addStats(&pss.Stats, ls.cp.Stats())
+		if ls.ap != nil {
+			addStats(&pss.Auth, ls.ap.Stats())
+		}
 	}
 	return &pss
 }
 
+func addStats(dst, s *pool.Stats) {
+	dst.Hits += s.Hits
+	dst.Misses += s.Misses
+	dst.Timeouts += s.Timeouts
+	dst.TotalConns += s.TotalConns
+	dst.IdleConns += s.IdleConns
+	dst.StaleConns += s.StaleConns
+	dst.DeadConns += s.DeadConns
+	dst.Waiters += s.Waiters
+	dst.Waits.Add(s.Waits)
+}
+
 func splitDC(base string) string {
 	pos1 := strings.Index(base, "=")
 	pos2 := strings.Index(base, ",")
@@ -141,9 +296,17 @@ func splitDC(base string) string {
 
 // Rename ...
 func (s *Store) Rename(oldUID, newUID string) (err error) {
-	for _, ls := range s.sources {
+	defer func() {
+		s.emit(audit.ActionRename, oldUID, []audit.Change{{Field: "uid", Old: oldUID, New: newUID}}, err)
+	}()
+	sources, err := s.writable(OpModifyDN)
+	if err != nil {
+		return
+	}
+	for _, ls := range sources {
 		err = ls.Rename(oldUID, newUID)
 		if err != nil {
+			err = ls.opError(OpModifyDN, ls.UDN(oldUID), err)
 			break
 		}
 	}
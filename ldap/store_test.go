@@ -0,0 +1,43 @@
+package ldap
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio-backend/audit"
+	"github.com/liut/staffio-backend/model"
+)
+
+func TestSaveValidate(t *testing.T) {
+	dir := newFakeDirectory()
+	sink := new(audit.MemorySink)
+	s := &Store{sources: []*ldapSource{dir.newSource()}, audit: sink}
+	defer s.Close()
+
+	staff := model.NewPeople("doe", "doe", "doe")
+	staff.Mobile = "12345"
+	staff.Gender = "男"
+	_, err := s.Save(staff)
+	assert.ErrorIs(t, err, model.ErrInvalidPeople)
+	var ve *model.ValidationError
+	if assert.ErrorAs(t, err, &ve) {
+		assert.True(t, ve.Has("mobile"))
+		assert.True(t, ve.Has("gender"))
+	}
+	assert.Empty(t, dir.callsOf("add"), "rejected before sent")
+	if events := sink.Events(); assert.Len(t, events, 1) {
+		assert.Equal(t, audit.OutcomeFailure, events[0].Outcome)
+	}
+
+	s.validator = &model.Validator{Required: []string{"uid"}, MobileRules: map[string]*regexp.Regexp{}}
+	_, err = s.Save(staff)
+	assert.ErrorIs(t, err, model.ErrInvalidPeople, "gender")
+	staff.Gender = "F"
+	staff.Mobile = "+8612345678"
+	isNew, err := s.Save(staff)
+	assert.NoError(t, err)
+	assert.True(t, isNew)
+	assert.Equal(t, "F", dir.attr(etPeople.DN("doe", fakeBase), "gender"))
+}
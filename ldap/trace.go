@@ -0,0 +1,174 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Tracer starts spans around LDAP operations, such as the adapter of OpenTelemetry in module ldap/oteltrace
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span)
+}
+
+// Span ...
+type Span interface {
+	SetAttributes(attrs ...Attr)
+	// End ends the span with the error of operation, nil if ok
+	End(err error)
+}
+
+// Attr attribute of span, Value is a string, int or bool
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// names of spans
+const (
+	SpanOp      = "ldap.op" // get a connection, bind and operate
+	SpanPoolGet = "ldap.pool.get"
+	SpanBind    = "ldap.bind"
+	SpanFindOne = "ldap.find_one"
+	SpanList    = "ldap.list"
+	SpanModify  = "ldap.modify"
+)
+
+// keys of span attributes
+const (
+	AttrAddr       = "ldap.addr"
+	AttrBase       = "ldap.base"
+	AttrFilter     = "ldap.filter" // values are redacted
+	AttrPool       = "ldap.pool"   // main or auth
+	AttrEntries    = "ldap.entries"
+	AttrResultCode = "ldap.result_code" // 0 if ok, -1 if not a LDAP error
+)
+
+// NoopTracer does nothing, the default
+var NoopTracer Tracer = noopTracer{}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...Attr) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attr) {}
+func (noopSpan) End(error)             {}
+
+// WithContext returns a shallow copy of Store, the spans of its operations are children of ctx
+// and waiting for a connection stops when ctx is done
+func (s *Store) WithContext(ctx context.Context) *Store {
+	s2 := *s
+	s2.sources = make([]*ldapSource, len(s.sources))
+	for i, ls := range s.sources {
+		s2.sources[i] = ls.withContext(ctx)
+	}
+	return &s2
+}
+
+func (ls *ldapSource) withContext(ctx context.Context) *ldapSource {
+	c := *ls
+	c.ctx = ctx
+	return &c
+}
+
+func (ls *ldapSource) context() context.Context {
+	if ls.ctx == nil {
+		return context.Background()
+	}
+	return ls.ctx
+}
+
+// trace starts a span, returns a copy of ls with the context of span
+func (ls *ldapSource) trace(name string, attrs ...Attr) (*ldapSource, Span) {
+	if ls.tracer == nil {
+		return ls, noopSpan{}
+	}
+	ctx, span := ls.tracer.Start(ls.context(), name, append([]Attr{{AttrAddr, ls.Addr}}, attrs...)...)
+	return ls.withContext(ctx), span
+}
+
+// client wraps c with the context of span for operations in opFunc
+func (ls *ldapSource) client(c ldap.Client) ldap.Client {
+	if ls.tracer == nil {
+		return c
+	}
+	return &tracedClient{Client: c, ctx: ls.context(), tracer: ls.tracer, addr: ls.Addr}
+}
+
+// tracedClient carries the context of span to functions like ldapFindOne
+type tracedClient struct {
+	ldap.Client
+
+	ctx    context.Context
+	tracer Tracer
+	addr   string
+}
+
+// startSpan starts a child span of c if it is traced
+func startSpan(c ldap.Client, name string, attrs ...Attr) Span {
+	tc, ok := c.(*tracedClient)
+	if !ok {
+		return noopSpan{}
+	}
+	_, span := tc.tracer.Start(tc.ctx, name, append([]Attr{{AttrAddr, tc.addr}}, attrs...)...)
+	return span
+}
+
+// endSpan sets the result code and ends span
+func endSpan(span Span, err error) {
+	span.SetAttributes(Attr{AttrResultCode, resultCode(err)})
+	span.End(err)
+}
+
+func resultCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var le *ldap.Error
+	if errors.As(err, &le) {
+		return int(le.ResultCode)
+	}
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return ldap.LDAPResultNoSuchObject
+	case errors.Is(err, ErrLogin):
+		return ldap.LDAPResultInvalidCredentials
+	}
+	return -1
+}
+
+// redactFilter replaces assertion values of filter with ?, keeps presence and objectClass,
+// e.g. (&(uid=?)(objectclass=inetOrgPerson))
+func redactFilter(filter string) string {
+	var sb strings.Builder
+	sb.Grow(len(filter))
+	start := 0 // start of attribute description
+	for i := 0; i < len(filter); i++ {
+		ch := filter[i]
+		sb.WriteByte(ch)
+		switch ch {
+		case '(':
+			start = i + 1
+		case '=':
+			end := strings.IndexByte(filter[i+1:], ')')
+			if end < 0 {
+				end = len(filter) - i - 1
+			}
+			value := filter[i+1 : i+1+end]
+			attr := strings.TrimRight(filter[start:i], "~<>:")
+			if value == "*" || strings.EqualFold(attr, "objectClass") {
+				sb.WriteString(value)
+			} else {
+				sb.WriteByte('?')
+			}
+			i += end
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,148 @@
+package ldap
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordTracer an in-memory span recorder
+type recordTracer struct {
+	mu    sync.Mutex
+	spans []*recordSpan
+}
+
+type recordSpan struct {
+	name   string
+	parent *recordSpan
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+type spanKey struct{}
+
+func (rt *recordTracer) Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*recordSpan)
+	s := &recordSpan{name: name, parent: parent, attrs: make(map[string]interface{})}
+	s.SetAttributes(attrs...)
+	rt.mu.Lock()
+	rt.spans = append(rt.spans, s)
+	rt.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (rt *recordTracer) named(name string) (out []*recordSpan) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	for _, s := range rt.spans {
+		if s.name == name {
+			out = append(out, s)
+		}
+	}
+	return
+}
+
+func (rt *recordTracer) reset() {
+	rt.mu.Lock()
+	rt.spans = nil
+	rt.mu.Unlock()
+}
+
+func (s *recordSpan) SetAttributes(attrs ...Attr) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordSpan) End(err error) {
+	s.err = err
+	s.ended = true
+}
+
+func TestTrace(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.addPeople("doe", "secret")
+	rt := new(recordTracer)
+	ls := dir.newSource()
+	ls.tracer = rt
+	store := &Store{sources: []*ldapSource{ls}, pageSize: 10}
+	defer store.Close()
+
+	ctx, root := rt.Start(context.Background(), "login")
+	s := store.WithContext(ctx)
+
+	_, err := s.Get("doe")
+	assert.NoError(t, err)
+	ops := rt.named(SpanOp)
+	if assert.Len(t, ops, 1) {
+		op := ops[0]
+		assert.Equal(t, root, op.parent)
+		assert.True(t, op.ended)
+		assert.Equal(t, "ldap://fake", op.attrs[AttrAddr])
+		assert.Equal(t, 0, op.attrs[AttrResultCode])
+		for _, name := range []string{SpanPoolGet, SpanBind, SpanFindOne} {
+			if spans := rt.named(name); assert.Len(t, spans, 1, name) {
+				assert.Equal(t, op, spans[0].parent, name)
+				assert.True(t, spans[0].ended, name)
+			}
+		}
+		assert.Equal(t, "main", rt.named(SpanPoolGet)[0].attrs[AttrPool])
+		find := rt.named(SpanFindOne)[0]
+		assert.Equal(t, "(&(uid=?)(objectclass=inetOrgPerson))", find.attrs[AttrFilter])
+		assert.Equal(t, fakeBase, find.attrs[AttrBase])
+	}
+
+	rt.reset()
+	_, err = s.Authenticate("doe", "bad")
+	assert.Error(t, err)
+	if binds := rt.named(SpanBind); assert.Len(t, binds, 1) {
+		assert.Equal(t, 49, binds[0].attrs[AttrResultCode])
+		assert.Error(t, binds[0].err)
+		assert.Equal(t, "auth", rt.named(SpanPoolGet)[0].attrs[AttrPool])
+	}
+	_, err = s.Get("nobody")
+	assert.ErrorIs(t, err, ErrNotFound)
+	finds := rt.named(SpanFindOne)
+	assert.Equal(t, 32, finds[len(finds)-1].attrs[AttrResultCode])
+
+	rt.reset()
+	data := s.All(&Spec{Name: "doe"})
+	assert.Len(t, data, 1)
+	if lists := rt.named(SpanList); assert.Len(t, lists, 1) {
+		assert.Equal(t, root, lists[0].parent)
+		assert.Equal(t, 1, lists[0].attrs[AttrEntries])
+		assert.Equal(t, "(&(cn=?)(objectclass=inetOrgPerson))", lists[0].attrs[AttrFilter])
+		assert.Equal(t, lists[0], rt.named(SpanOp)[0].parent)
+	}
+
+	rt.reset()
+	assert.NoError(t, s.ModifyBySelf("doe", "secret", &People{UID: "doe", CommonName: "doe", Surname: "doe", Nickname: "Doe"}))
+	if mods := rt.named(SpanModify); assert.Len(t, mods, 1) {
+		assert.Equal(t, root, mods[0].parent)
+		assert.Equal(t, mods[0], rt.named(SpanFindOne)[0].parent.parent)
+	}
+
+	// no context, root spans
+	rt.reset()
+	_, err = store.Get("doe")
+	assert.NoError(t, err)
+	assert.Nil(t, rt.named(SpanOp)[0].parent)
+}
+
+func TestRedactFilter(t *testing.T) {
+	cases := map[string]string{
+		"(uid=doe)": "(uid=?)",
+		"(&(uid=doe)(objectClass=inetOrgPerson))": "(&(uid=?)(objectClass=inetOrgPerson))",
+		"(&(|(uid=a\\29b)(uid=c))(mail=*))":       "(&(|(uid=?)(uid=?))(mail=*))",
+		"(cn=*doe*)":                              "(cn=?)",
+		"(!(createTimestamp>=20200101000000Z))":   "(!(createTimestamp>=?))",
+		"(userPrincipalName:caseExactMatch:=a@b)": "(userPrincipalName:caseExactMatch:=?)",
+		"(uid=broken":                             "(uid=?",
+	}
+	for in, want := range cases {
+		assert.Equal(t, want, redactFilter(in), in)
+	}
+}
@@ -0,0 +1,112 @@
+package ldap
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	oidAssertion = "1.3.6.1.1.12" // RFC 4528
+)
+
+// versionAttrs operational attributes of the version token of an entry, by precedence
+var versionAttrs = []string{"entryCSN", "uSNChanged", "modifyTimestamp"}
+
+// versionOf returns the version token of entry and its attribute, empty if none
+func versionOf(entry *ldap.Entry) (version, attr string) {
+	for _, attr = range versionAttrs {
+		if version = entry.GetAttributeValue(attr); version != "" {
+			return
+		}
+	}
+	return "", ""
+}
+
+// controlAssertion the assertion control of RFC 4528, the operation fails with assertionFailed
+// if the entry does not match the filter
+type controlAssertion struct {
+	filter *ber.Packet
+	str    string
+}
+
+func newControlAssertion(filter string) (*controlAssertion, error) {
+	p, err := ldap.CompileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return &controlAssertion{filter: p, str: filter}, nil
+}
+
+// GetControlType ...
+func (c *controlAssertion) GetControlType() string {
+	return oidAssertion
+}
+
+// Encode ...
+func (c *controlAssertion) Encode() *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Control")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, oidAssertion, "Control Type (Assertion)"))
+	packet.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, true, "Criticality"))
+	value := ber.Encode(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, nil, "Control Value (Assertion)")
+	value.AppendChild(c.filter)
+	packet.AppendChild(value)
+	return packet
+}
+
+// String ...
+func (c *controlAssertion) String() string {
+	return fmt.Sprintf("Control Type: %s (%q)  Criticality: true  Filter: %s", ldap.ControlTypeMap[oidAssertion], oidAssertion, c.str)
+}
+
+// expectVersion returns ErrConflict if the version of entry is not expected, or the assertion control of
+// the version for the update if useAssert, nothing if expected is empty
+func expectVersion(entry *ldap.Entry, expected string, useAssert bool) ([]ldap.Control, error) {
+	if expected == "" {
+		return nil, nil
+	}
+	version, attr := versionOf(entry)
+	if version != expected {
+		return nil, fmt.Errorf("%w: version of %s is %q, not %q", ErrConflict, entry.DN, version, expected)
+	}
+	if !useAssert {
+		return nil, nil
+	}
+	ctl, err := newControlAssertion("(" + attr + "=" + ldap.EscapeFilter(expected) + ")")
+	if err != nil {
+		return nil, err
+	}
+	return []ldap.Control{ctl}, nil
+}
+
+// versionError returns ErrConflict if the assertion of version failed
+func versionError(err error) error {
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultAssertionFailed) {
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+	return err
+}
+
+// useAssertion reports whether the server supports the assertion control, detected once
+func (ls *ldapSource) useAssertion() bool {
+	switch atomic.LoadInt32(ls.assertCtl) {
+	case 1:
+		return true
+	case 2:
+		return false
+	}
+	ok, err := ls.supported("supportedControl", oidAssertion)
+	if err != nil {
+		logger().Infow("detect assertion control fail", "addr", ls.Addr, "err", err)
+		return false
+	}
+	if ok {
+		atomic.StoreInt32(ls.assertCtl, 1)
+	} else {
+		logger().Infow("assertion control unsupported, compare version before modify", "addr", ls.Addr)
+		atomic.StoreInt32(ls.assertCtl, 2)
+	}
+	return ok
+}
@@ -0,0 +1,127 @@
+package ldap
+
+import (
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionOf(t *testing.T) {
+	v, attr := versionOf(ldap.NewEntry("uid=doe", map[string][]string{"modifyTimestamp": {"20240101000000Z"}}))
+	assert.Equal(t, "20240101000000Z", v)
+	assert.Equal(t, "modifyTimestamp", attr)
+	v, attr = versionOf(ldap.NewEntry("uid=doe", map[string][]string{"modifyTimestamp": {"20240101000000Z"}, "uSNChanged": {"123"}}))
+	assert.Equal(t, "123", v)
+	assert.Equal(t, "uSNChanged", attr)
+	v, _ = versionOf(ldap.NewEntry("uid=doe", nil))
+	assert.Empty(t, v)
+}
+
+func TestControlAssertion(t *testing.T) {
+	ctl, err := newControlAssertion("(entryCSN=20240101000000.000001Z#000000#000#000000)")
+	if !assert.NoError(t, err) {
+		return
+	}
+	p := ctl.Encode()
+	if assert.Len(t, p.Children, 3) {
+		assert.Equal(t, oidAssertion, p.Children[0].Value)
+		assert.Equal(t, true, p.Children[1].Value)
+		// the value is the BER of filter
+		value := ber.DecodePacket(p.Children[2].Data.Bytes())
+		f, err := ldap.DecompileFilter(value)
+		assert.NoError(t, err)
+		assert.Equal(t, "(entryCSN=20240101000000.000001Z#000000#000#000000)", f)
+	}
+	assert.Contains(t, ctl.String(), oidAssertion)
+
+	_, err = newControlAssertion("(bad")
+	assert.Error(t, err)
+}
+
+func TestOptimisticPeople(t *testing.T) {
+	for _, assertion := range []bool{true, false} {
+		dir := newFakeDirectory()
+		if assertion {
+			dir.controls = []string{oidAssertion}
+		}
+		dn := dir.addPeople("doe", "secret")
+		s := &Store{sources: []*ldapSource{dir.newSource()}}
+
+		a, err := s.Get("doe")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NotEmpty(t, a.Version)
+		b := *a
+
+		a.Nickname = "A"
+		_, err = s.Save(a)
+		assert.NoError(t, err)
+		assert.Equal(t, assertion, s.sources[0].useAssertion())
+
+		b.Nickname = "B"
+		_, err = s.Save(&b)
+		assert.ErrorIs(t, err, ErrConflict)
+		var oe *OpError
+		if assert.ErrorAs(t, err, &oe) {
+			assert.Equal(t, CategoryConflict, oe.Category)
+		}
+		assert.Equal(t, "A", dir.attr(dn, "displayName"))
+
+		assert.ErrorIs(t, s.ModifyBySelf("doe", "secret", &b), ErrConflict)
+		p := &PeoplePatch{Version: b.Version}
+		_ = p.Set("nickname", "B")
+		assert.ErrorIs(t, s.Patch("doe", p), ErrConflict)
+
+		// no version, last write wins
+		b.Version = ""
+		assert.NoError(t, s.ModifyBySelf("doe", "secret", &b))
+		assert.Equal(t, "B", dir.attr(dn, "displayName"))
+		s.Close()
+	}
+}
+
+func TestAssertionFailed(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.controls = []string{oidAssertion}
+	dn := dir.addPeople("doe", "secret")
+	ls := dir.newSource()
+	defer ls.Close()
+
+	staff, err := ls.GetPeople("doe")
+	if !assert.NoError(t, err) {
+		return
+	}
+	// changed between the read of the entry and the modify
+	ctls, err := expectVersion(ldap.NewEntry(dn, map[string][]string{"entryCSN": {staff.Version}}), staff.Version, true)
+	assert.NoError(t, err)
+	dir.touch(dir.get(dn))
+	err = ls.opWithMan(func(c ldap.Client) error {
+		mr := ldap.NewModifyRequest(dn, ctls)
+		mr.Replace("displayName", []string{"A"})
+		return versionError(c.Modify(mr))
+	})
+	assert.ErrorIs(t, err, ErrConflict)
+	assert.True(t, ldap.IsErrorWithCode(err, ldap.LDAPResultAssertionFailed))
+}
+
+func TestOptimisticGroup(t *testing.T) {
+	dir := newFakeDirectory()
+	dir.addPeople("doe", "secret")
+	s := &Store{sources: []*ldapSource{dir.newSource()}}
+	defer s.Close()
+
+	assert.NoError(t, s.SaveGroup(&Group{Name: "dev", Members: []string{"doe"}}))
+	g, err := s.GetGroup("dev")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotEmpty(t, g.Version)
+	stale := *g
+	g.Members = []string{"doe", "roe"}
+	assert.NoError(t, s.SaveGroup(g))
+	stale.Members = nil
+	assert.ErrorIs(t, s.SaveGroup(&stale), ErrConflict)
+}
@@ -0,0 +1,262 @@
+// Package limiter slows down and locks out brute-force attempts of an Authenticator
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/liut/staffio-backend/model"
+)
+
+// vars
+var (
+	ErrTooManyAttempts = errors.New("too many attempts, try again later")
+)
+
+// defaults
+const (
+	DefaultMaxFailures       = 5
+	DefaultMaxClientFailures = 20
+	DefaultBaseDelay         = time.Second
+	DefaultMaxDelay          = 30 * time.Second
+	DefaultLockoutDuration   = 15 * time.Minute
+	DefaultResetAfter        = 15 * time.Minute
+
+	sweepEvery = 128
+)
+
+// AttemptError refused attempt, matches ErrTooManyAttempts with errors.Is
+type AttemptError struct {
+	Key        string
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (e *AttemptError) Error() string {
+	return fmt.Sprintf("%s (retry after %s)", ErrTooManyAttempts, e.RetryAfter)
+}
+
+// Is ...
+func (e *AttemptError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// Options of Limiter, zero fields take the defaults
+type Options struct {
+	Store Store
+	Now   func() time.Time
+
+	MaxFailures       int           // failures of an uid before lockout, negative to disable lockout
+	MaxClientFailures int           // failures of a client key before lockout, negative to disable lockout
+	BaseDelay         time.Duration // backoff after the first failure, doubled for each one next
+	MaxDelay          time.Duration // max of backoff
+	LockoutDuration   time.Duration // how long a locked key is refused
+	ResetAfter        time.Duration // failures are forgotten after this quiet period
+
+	// IsFailure reports whether an error of the inner Authenticator is a failed login,
+	// default is model.ErrLogin, so an outage of the directory locks out nobody
+	IsFailure func(err error) bool
+}
+
+// Limiter wraps an Authenticator with per-uid and per-client failure counters.
+// An attempt in flight counts as a failure of its keys until the result,
+// so parallel attempts can not pass the backoff or lockout together.
+// In-flight attempts are local to the Limiter, even with a shared Store.
+type Limiter struct {
+	auth model.Authenticator
+	opt  Options
+
+	mu      sync.Mutex
+	pending map[string]int // attempts in flight of each key
+	fails   uint32         // atomic, failures since last sweep
+}
+
+var _ model.Authenticator = (*Limiter)(nil)
+
+type limitKey struct {
+	name string
+	max  int
+}
+
+// New ...
+func New(auth model.Authenticator, opt *Options) *Limiter {
+	l := &Limiter{auth: auth, pending: make(map[string]int)}
+	if opt != nil {
+		l.opt = *opt
+	}
+	if l.opt.Store == nil {
+		l.opt.Store = NewMemoryStore()
+	}
+	if l.opt.Now == nil {
+		l.opt.Now = time.Now
+	}
+	if l.opt.MaxFailures == 0 {
+		l.opt.MaxFailures = DefaultMaxFailures
+	}
+	if l.opt.MaxClientFailures == 0 {
+		l.opt.MaxClientFailures = DefaultMaxClientFailures
+	}
+	if l.opt.BaseDelay == 0 {
+		l.opt.BaseDelay = DefaultBaseDelay
+	}
+	if l.opt.MaxDelay == 0 {
+		l.opt.MaxDelay = DefaultMaxDelay
+	}
+	if l.opt.LockoutDuration == 0 {
+		l.opt.LockoutDuration = DefaultLockoutDuration
+	}
+	if l.opt.ResetAfter == 0 {
+		l.opt.ResetAfter = DefaultResetAfter
+	}
+	if l.opt.IsFailure == nil {
+		l.opt.IsFailure = func(err error) bool { return errors.Is(err, model.ErrLogin) }
+	}
+	return l
+}
+
+// Authenticate limited by uid only
+func (l *Limiter) Authenticate(uid, passwd string) (*model.People, error) {
+	return l.AuthenticateFrom("", uid, passwd)
+}
+
+// AuthenticateFrom limited by uid and clientKey (like a remote address)
+func (l *Limiter) AuthenticateFrom(clientKey, uid, passwd string) (*model.People, error) {
+	keys := l.keys(clientKey, uid)
+
+	// reserve the attempt with the check, released with the result
+	l.mu.Lock()
+	err := l.check(l.opt.Now(), keys)
+	if err == nil {
+		l.reserve(keys, 1)
+	}
+	l.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	staff, err := l.auth.Authenticate(uid, passwd)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reserve(keys, -1)
+	if err != nil {
+		if l.opt.IsFailure(err) {
+			l.fail(l.opt.Now(), keys)
+		}
+		return staff, err
+	}
+
+	l.opt.Store.Delete(keys[0].name)
+	return staff, nil
+}
+
+// Unlock clears failures of uid
+func (l *Limiter) Unlock(uid string) {
+	l.opt.Store.Delete(uidKey(uid))
+}
+
+// UnlockClient clears failures of clientKey
+func (l *Limiter) UnlockClient(clientKey string) {
+	l.opt.Store.Delete(clientKeyOf(clientKey))
+}
+
+func uidKey(uid string) string {
+	return "uid:" + uid
+}
+
+func clientKeyOf(key string) string {
+	return "client:" + key
+}
+
+func (l *Limiter) keys(clientKey, uid string) []limitKey {
+	keys := []limitKey{{uidKey(uid), l.opt.MaxFailures}}
+	if clientKey != "" {
+		keys = append(keys, limitKey{clientKeyOf(clientKey), l.opt.MaxClientFailures})
+	}
+	return keys
+}
+
+// check refuses an attempt of keys locked, in backoff, or with as many attempts in flight
+// as would lock it out, l.mu held
+func (l *Limiter) check(now time.Time, keys []limitKey) error {
+	for _, k := range keys {
+		e, ok := l.opt.Store.Load(k.name)
+		if !ok || !now.Before(e.Expires) {
+			e = Entry{}
+		}
+		if now.Before(e.LockedUntil) {
+			return &AttemptError{Key: k.name, Locked: true, RetryAfter: e.LockedUntil.Sub(now)}
+		}
+		inflight := l.pending[k.name]
+		if k.max > 0 && e.Failures+inflight >= k.max {
+			return &AttemptError{Key: k.name, RetryAfter: l.backoff(e.Failures + inflight)}
+		}
+		if e.Failures == 0 {
+			continue
+		}
+		// in backoff, the attempt in flight is the last failure until its result
+		if inflight > 0 {
+			return &AttemptError{Key: k.name, RetryAfter: l.backoff(e.Failures + inflight)}
+		}
+		if next := e.LastFailure.Add(l.backoff(e.Failures)); now.Before(next) {
+			return &AttemptError{Key: k.name, RetryAfter: next.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// reserve adds n attempts in flight of keys, l.mu held
+func (l *Limiter) reserve(keys []limitKey, n int) {
+	for _, k := range keys {
+		if c := l.pending[k.name] + n; c > 0 {
+			l.pending[k.name] = c
+		} else {
+			delete(l.pending, k.name)
+		}
+	}
+}
+
+// fail records a failure of keys, l.mu held
+func (l *Limiter) fail(now time.Time, keys []limitKey) {
+	for _, k := range keys {
+		e, ok := l.opt.Store.Load(k.name)
+		if !ok || !now.Before(e.Expires) {
+			e = Entry{}
+		}
+		e.Failures++
+		e.LastFailure = now
+		e.Expires = now.Add(l.opt.ResetAfter)
+		if k.max > 0 && e.Failures >= k.max {
+			e.Failures = 0
+			e.LockedUntil = now.Add(l.opt.LockoutDuration)
+			if e.LockedUntil.After(e.Expires) {
+				e.Expires = e.LockedUntil
+			}
+		}
+		l.opt.Store.Save(k.name, e)
+	}
+
+	if atomic.AddUint32(&l.fails, 1)%sweepEvery == 0 {
+		if sw, ok := l.opt.Store.(sweeper); ok {
+			sw.Sweep(now)
+		}
+	}
+}
+
+// backoff returns the delay after n failures
+func (l *Limiter) backoff(n int) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	if n > 32 {
+		return l.opt.MaxDelay
+	}
+	d := l.opt.BaseDelay << uint(n-1)
+	if d <= 0 || d > l.opt.MaxDelay {
+		return l.opt.MaxDelay
+	}
+	return d
+}
@@ -0,0 +1,82 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Entry failure counter of a key
+type Entry struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+	LockedUntil time.Time `json:"lockedUntil,omitempty"`
+	Expires     time.Time `json:"expires"`
+}
+
+// Store keeps failure counters, the implementation must be safe for concurrent use
+type Store interface {
+	Load(key string) (Entry, bool)
+	Save(key string, e Entry)
+	Delete(key string)
+}
+
+type sweeper interface {
+	Sweep(now time.Time) int
+}
+
+// MemoryStore in-memory Store, the default
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore ...
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry)}
+}
+
+// Load ...
+func (s *MemoryStore) Load(key string) (Entry, bool) {
+	s.mu.Lock()
+	e, ok := s.entries[key]
+	s.mu.Unlock()
+	return e, ok
+}
+
+// Save ...
+func (s *MemoryStore) Save(key string, e Entry) {
+	s.mu.Lock()
+	s.entries[key] = e
+	s.mu.Unlock()
+}
+
+// Delete ...
+func (s *MemoryStore) Delete(key string) {
+	s.mu.Lock()
+	delete(s.entries, key)
+	s.mu.Unlock()
+}
+
+// Len returns number of entries
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	n := len(s.entries)
+	s.mu.Unlock()
+	return n
+}
+
+// Sweep removes expired entries, return number of removed
+func (s *MemoryStore) Sweep(now time.Time) int {
+	var n int
+	s.mu.Lock()
+	for k, e := range s.entries {
+		if !now.Before(e.Expires) {
+			delete(s.entries, k)
+			n++
+		}
+	}
+	s.mu.Unlock()
+	return n
+}
@@ -0,0 +1,272 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio-backend/model"
+)
+
+var errLogin = fmt.Errorf("bad login: %w", model.ErrLogin)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+type fakeAuth struct {
+	passwords map[string]string
+	calls     int
+}
+
+func (a *fakeAuth) Authenticate(uid, passwd string) (*model.People, error) {
+	a.calls++
+	if p, ok := a.passwords[uid]; ok && p == passwd {
+		return model.NewPeople(uid), nil
+	}
+	return nil, errLogin
+}
+
+func newTestLimiter() (*Limiter, *fakeAuth, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	auth := &fakeAuth{passwords: map[string]string{"doe": "secret", "cat": "meow"}}
+	l := New(auth, &Options{
+		Now:               clock.Now,
+		MaxFailures:       3,
+		MaxClientFailures: 5,
+		BaseDelay:         time.Second,
+		MaxDelay:          4 * time.Second,
+		LockoutDuration:   time.Minute,
+		ResetAfter:        10 * time.Minute,
+	})
+	return l, auth, clock
+}
+
+func TestBackoff(t *testing.T) {
+	l, auth, clock := newTestLimiter()
+
+	_, err := l.Authenticate("doe", "bad")
+	assert.Equal(t, errLogin, err)
+	assert.Equal(t, 1, auth.calls)
+
+	// within backoff, inner is not called
+	_, err = l.Authenticate("doe", "secret")
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+	var ae *AttemptError
+	if assert.True(t, errors.As(err, &ae)) {
+		assert.False(t, ae.Locked)
+		assert.Equal(t, time.Second, ae.RetryAfter)
+	}
+	assert.Equal(t, 1, auth.calls)
+
+	clock.Advance(time.Second)
+	_, err = l.Authenticate("doe", "bad")
+	assert.Equal(t, errLogin, err)
+
+	// doubled
+	clock.Advance(time.Second)
+	_, err = l.Authenticate("doe", "secret")
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+	clock.Advance(time.Second)
+	staff, err := l.Authenticate("doe", "secret")
+	assert.NoError(t, err)
+	assert.NotNil(t, staff)
+
+	// success clears the counter
+	_, err = l.Authenticate("doe", "bad")
+	assert.Equal(t, errLogin, err)
+	_, err = l.Authenticate("doe", "secret")
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+	assert.Equal(t, time.Second, l.backoff(1))
+	assert.Equal(t, 4*time.Second, l.backoff(10))
+	assert.Equal(t, 4*time.Second, l.backoff(100))
+}
+
+func TestLockout(t *testing.T) {
+	l, auth, clock := newTestLimiter()
+
+	for i := 0; i < 3; i++ {
+		_, err := l.Authenticate("doe", "bad")
+		assert.Equal(t, errLogin, err)
+		clock.Advance(5 * time.Second)
+	}
+
+	calls := auth.calls
+	_, err := l.Authenticate("doe", "secret")
+	var ae *AttemptError
+	if assert.True(t, errors.As(err, &ae)) {
+		assert.True(t, ae.Locked)
+		assert.Equal(t, "uid:doe", ae.Key)
+		assert.Equal(t, 55*time.Second, ae.RetryAfter)
+	}
+	assert.Equal(t, calls, auth.calls)
+
+	// others are not affected
+	_, err = l.Authenticate("cat", "meow")
+	assert.NoError(t, err)
+
+	clock.Advance(55 * time.Second)
+	_, err = l.Authenticate("doe", "secret")
+	assert.NoError(t, err)
+
+	// unlock by administrator
+	for i := 0; i < 3; i++ {
+		_, _ = l.Authenticate("doe", "bad")
+		clock.Advance(5 * time.Second)
+	}
+	_, err = l.Authenticate("doe", "secret")
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+	l.Unlock("doe")
+	_, err = l.Authenticate("doe", "secret")
+	assert.NoError(t, err)
+}
+
+func TestClientKey(t *testing.T) {
+	l, _, clock := newTestLimiter()
+	client := "10.0.0.1"
+
+	// spraying different uids from one client
+	for _, uid := range []string{"u1", "u2", "u3", "u4", "u5"} {
+		_, err := l.AuthenticateFrom(client, uid, "123456")
+		assert.Equal(t, errLogin, err)
+		clock.Advance(5 * time.Second)
+	}
+
+	_, err := l.AuthenticateFrom(client, "doe", "secret")
+	var ae *AttemptError
+	if assert.True(t, errors.As(err, &ae)) {
+		assert.True(t, ae.Locked)
+		assert.Equal(t, "client:"+client, ae.Key)
+	}
+
+	// another client
+	_, err = l.AuthenticateFrom("10.0.0.2", "doe", "secret")
+	assert.NoError(t, err)
+
+	l.UnlockClient(client)
+	_, err = l.AuthenticateFrom(client, "doe", "secret")
+	assert.NoError(t, err)
+}
+
+func TestResetAfter(t *testing.T) {
+	l, _, clock := newTestLimiter()
+	store := l.opt.Store.(*MemoryStore)
+
+	_, _ = l.Authenticate("doe", "bad")
+	clock.Advance(5 * time.Second)
+	_, _ = l.Authenticate("doe", "bad")
+	assert.Equal(t, 1, store.Len())
+
+	clock.Advance(10 * time.Minute)
+	assert.Equal(t, 1, store.Sweep(clock.Now()))
+	assert.Zero(t, store.Len())
+
+	// counting starts over, the third failure does not lock
+	_, _ = l.Authenticate("doe", "bad")
+	clock.Advance(5 * time.Second)
+	_, err := l.Authenticate("doe", "secret")
+	assert.NoError(t, err)
+}
+
+func TestIsFailure(t *testing.T) {
+	errNetwork := errors.New("network")
+	auth := model.Authenticator(authFunc(func(uid, passwd string) (*model.People, error) {
+		return nil, errNetwork
+	}))
+	l := New(auth, &Options{IsFailure: func(err error) bool { return err == errLogin }})
+	for i := 0; i < 10; i++ {
+		_, err := l.Authenticate("doe", "secret")
+		assert.Equal(t, errNetwork, err)
+	}
+	assert.Zero(t, l.opt.Store.(*MemoryStore).Len())
+
+	// by default only model.ErrLogin is a failure, an outage locks out nobody
+	l = New(auth, nil)
+	for i := 0; i < 10; i++ {
+		_, err := l.AuthenticateFrom("10.0.0.1", "doe", "secret")
+		assert.Equal(t, errNetwork, err)
+	}
+	assert.Zero(t, l.opt.Store.(*MemoryStore).Len())
+	assert.Empty(t, l.pending)
+}
+
+func TestParallelAttempts(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	auth := authFunc(func(uid, passwd string) (*model.People, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return nil, errLogin
+	})
+	clock := &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := New(auth, &Options{Now: clock.Now, MaxFailures: 3, LockoutDuration: time.Minute})
+
+	// spraying in parallel, attempts in flight count as failures
+	const n = 10
+	refused := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := l.Authenticate("doe", "bad"); errors.Is(err, ErrTooManyAttempts) {
+				refused <- err
+			}
+		}()
+	}
+	for i := 0; i < n-3; i++ {
+		<-refused
+	}
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Empty(t, l.pending)
+
+	_, err := l.Authenticate("doe", "secret")
+	var ae *AttemptError
+	if assert.True(t, errors.As(err, &ae)) {
+		assert.True(t, ae.Locked)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// in backoff, one attempt at a time
+	l = New(auth, &Options{Now: clock.Now, MaxFailures: -1})
+	release = make(chan struct{})
+	calls = 0
+	l.mu.Lock()
+	l.fail(clock.Now(), l.keys("", "doe"))
+	l.mu.Unlock()
+	clock.Advance(time.Minute)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = l.Authenticate("doe", "bad")
+	}()
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	_, err = l.Authenticate("doe", "bad")
+	assert.ErrorIs(t, err, ErrTooManyAttempts)
+	close(release)
+	<-done
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+type authFunc func(uid, passwd string) (*model.People, error)
+
+func (f authFunc) Authenticate(uid, passwd string) (*model.People, error) {
+	return f(uid, passwd)
+}
@@ -17,9 +17,14 @@ func init() {
 	Default = &logger{slg: slog.Default()}
 }
 
-func SetLogger(logger Logger) {
-	if logger != nil {
-		Default = logger
+// SetLogger replaces Default, values which implement slog.LogValuer are resolved before logged,
+// so a logger such as zap also gets redacted values, wrap zap by zaplog.Wrap to keep its callers
+func SetLogger(l Logger) {
+	if l != nil {
+		if _, ok := l.(*logger); !ok {
+			l = newResolver(l)
+		}
+		Default = l
 	}
 }
 
@@ -0,0 +1,75 @@
+package log
+
+import (
+	"log/slog"
+)
+
+// CallerSkipper a Logger which reports its callers, WithCallerSkip returns one which skips more frames
+type CallerSkipper interface {
+	WithCallerSkip(skip int) Logger
+}
+
+// resolver resolves values of slog.LogValuer for a Logger which does not know them
+type resolver struct {
+	Logger
+}
+
+// newResolver wraps l, which skips the frame of resolver if it reports callers
+func newResolver(l Logger) *resolver {
+	if x, ok := l.(CallerSkipper); ok {
+		l = x.WithCallerSkip(1)
+	}
+	return &resolver{Logger: l}
+}
+
+func (r *resolver) Debugw(msg string, keysAndValues ...interface{}) {
+	r.Logger.Debugw(msg, resolveValues(keysAndValues)...)
+}
+
+func (r *resolver) Infow(msg string, keysAndValues ...interface{}) {
+	r.Logger.Infow(msg, resolveValues(keysAndValues)...)
+}
+
+func (r *resolver) Warnw(msg string, keysAndValues ...interface{}) {
+	r.Logger.Warnw(msg, resolveValues(keysAndValues)...)
+}
+
+func (r *resolver) Errorw(msg string, keysAndValues ...interface{}) {
+	r.Logger.Errorw(msg, resolveValues(keysAndValues)...)
+}
+
+func (r *resolver) Fatalw(msg string, keysAndValues ...interface{}) {
+	r.Logger.Fatalw(msg, resolveValues(keysAndValues)...)
+}
+
+// resolveValues returns keysAndValues with LogValuers resolved, a copy only if any
+func resolveValues(keysAndValues []interface{}) []interface{} {
+	var out []interface{}
+	for i, v := range keysAndValues {
+		lv, ok := v.(slog.LogValuer)
+		if !ok {
+			continue
+		}
+		if out == nil {
+			out = append([]interface{}(nil), keysAndValues...)
+		}
+		out[i] = valueOf(slog.AnyValue(lv).Resolve())
+	}
+	if out == nil {
+		return keysAndValues
+	}
+	return out
+}
+
+// valueOf returns a plain value of v, a group is a map
+func valueOf(v slog.Value) interface{} {
+	if v.Kind() != slog.KindGroup {
+		return v.Any()
+	}
+	attrs := v.Group()
+	m := make(map[string]interface{}, len(attrs))
+	for _, a := range attrs {
+		m[a.Key] = valueOf(a.Value.Resolve())
+	}
+	return m
+}
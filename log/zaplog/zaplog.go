@@ -0,0 +1,25 @@
+// Package zaplog adapts a zap.SugaredLogger to log.Logger, keeping zap out of package log
+package zaplog
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/liut/staffio-backend/log"
+)
+
+// Logger a zap.SugaredLogger which implements log.CallerSkipper
+type Logger struct {
+	*zap.SugaredLogger
+}
+
+var _ log.CallerSkipper = (*Logger)(nil)
+
+// Wrap returns l as a log.Logger for log.SetLogger
+func Wrap(l *zap.SugaredLogger) *Logger {
+	return &Logger{SugaredLogger: l}
+}
+
+// WithCallerSkip returns a Logger which skips more frames of callers
+func (l *Logger) WithCallerSkip(skip int) log.Logger {
+	return Wrap(l.WithOptions(zap.AddCallerSkip(skip)))
+}
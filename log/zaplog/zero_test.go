@@ -0,0 +1,34 @@
+package zaplog
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/liut/staffio-backend/log"
+)
+
+type secret string
+
+func (s secret) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("value", "***"), slog.Int("len", len(s)))
+}
+
+func TestSetLoggerCaller(t *testing.T) {
+	saved := log.GetLogger()
+	defer func() { log.Default = saved }()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	log.SetLogger(Wrap(zap.New(core, zap.AddCaller()).Sugar()))
+	log.GetLogger().Infow("test", "password", secret("abc"))
+
+	if entries := logs.All(); assert.Len(t, entries, 1) {
+		assert.Equal(t, "zero_test.go", filepath.Base(entries[0].Caller.File), "the caller, not the resolver")
+		assert.Equal(t, map[string]interface{}{"value": "***", "len": int64(3)}, entries[0].ContextMap()["password"])
+	}
+}
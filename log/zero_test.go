@@ -0,0 +1,43 @@
+package log
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type secret string
+
+func (s secret) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("value", "***"), slog.Int("len", len(s)))
+}
+
+type recorder struct {
+	Logger
+	kvs []interface{}
+}
+
+func (r *recorder) Infow(msg string, keysAndValues ...interface{}) {
+	r.kvs = keysAndValues
+}
+
+func TestSetLogger(t *testing.T) {
+	saved := Default
+	defer func() { Default = saved }()
+
+	rec := new(recorder)
+	SetLogger(rec)
+	assert.IsType(t, &resolver{}, GetLogger())
+
+	kvs := []interface{}{"uid", "doe", "password", secret("abc")}
+	GetLogger().Infow("test", kvs...)
+	assert.Equal(t, []interface{}{"uid", "doe", "password", map[string]interface{}{"value": "***", "len": int64(3)}}, rec.kvs)
+	assert.Equal(t, secret("abc"), kvs[3], "not changed")
+
+	GetLogger().Infow("test", "uid", "doe")
+	assert.Equal(t, []interface{}{"uid", "doe"}, rec.kvs)
+
+	SetLogger(saved)
+	assert.Equal(t, saved, GetLogger())
+}
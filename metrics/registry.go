@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// names of metric families of operations
+const (
+	NameOperations = "staffio_ldap_operations_total"
+	NameErrors     = "staffio_ldap_errors_total"
+	NameDuration   = "staffio_ldap_operation_duration_seconds"
+)
+
+// DurationBounds upper bounds of buckets of operation duration
+var DurationBounds = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+type opKey struct {
+	op, addr string
+}
+
+type opStats struct {
+	count  uint64
+	errors map[string]uint64 // result code: count
+	counts []uint64
+	sum    time.Duration
+}
+
+// Registry records operations by op and address of source, and collects registered Collectors
+type Registry struct {
+	mu         sync.Mutex
+	ops        map[opKey]*opStats
+	collectors []Collector
+}
+
+var _ http.Handler = (*Registry)(nil)
+
+// NewRegistry ...
+func NewRegistry() *Registry {
+	return &Registry{ops: make(map[opKey]*opStats)}
+}
+
+// Register adds a Collector, such as *ldap.Store for stats of pools
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mu.Unlock()
+}
+
+// Observe records an operation, such as bind, search, add, modify, delete and passwd
+func (r *Registry) Observe(op, addr string, d time.Duration, err error) {
+	i := 0
+	for i < len(DurationBounds) && d > DurationBounds[i] {
+		i++
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := opKey{op, addr}
+	s := r.ops[k]
+	if s == nil {
+		s = &opStats{errors: make(map[string]uint64), counts: make([]uint64, len(DurationBounds)+1)}
+		r.ops[k] = s
+	}
+	s.count++
+	s.counts[i]++
+	s.sum += d
+	if err != nil {
+		s.errors[ResultCode(err)]++
+	}
+}
+
+// ResultCode returns result code of a LDAP error, or "other"
+func ResultCode(err error) string {
+	var le *ldap.Error
+	if errors.As(err, &le) {
+		return strconv.Itoa(int(le.ResultCode))
+	}
+	return "other"
+}
+
+// Collect writes metrics of operations
+func (r *Registry) Collect(w *Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.ops) == 0 {
+		return
+	}
+	keys := make([]opKey, 0, len(r.ops))
+	for k := range r.ops {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].op != keys[j].op {
+			return keys[i].op < keys[j].op
+		}
+		return keys[i].addr < keys[j].addr
+	})
+
+	w.Header(NameOperations, TypeCounter, "Number of LDAP operations.")
+	for _, k := range keys {
+		w.Sample(NameOperations, L("op", k.op, "addr", k.addr), float64(r.ops[k].count))
+	}
+	w.Header(NameErrors, TypeCounter, "Number of failed LDAP operations by result code.")
+	for _, k := range keys {
+		s := r.ops[k]
+		codes := make([]string, 0, len(s.errors))
+		for code := range s.errors {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			w.Sample(NameErrors, L("op", k.op, "addr", k.addr, "code", code), float64(s.errors[code]))
+		}
+	}
+	w.Header(NameDuration, TypeHistogram, "Duration of LDAP operations.")
+	for _, k := range keys {
+		s := r.ops[k]
+		w.Histogram(NameDuration, L("op", k.op, "addr", k.addr), DurationBounds, s.counts, s.sum)
+	}
+}
+
+// WriteTo writes all metrics in Prometheus text format
+func (r *Registry) WriteTo(out io.Writer) (int64, error) {
+	w := NewWriter(out)
+	r.Collect(w)
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+	for _, c := range collectors {
+		c.Collect(w)
+	}
+	err := w.Flush()
+	return w.n, err
+}
+
+// ServeHTTP serves metrics for scraping of Prometheus
+func (r *Registry) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", ContentType)
+	_, _ = r.WriteTo(rw)
+}
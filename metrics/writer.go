@@ -0,0 +1,132 @@
+// Package metrics records LDAP operations and exposes metrics in Prometheus text format,
+// without a dependency of metrics library
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// types of metric family
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// ContentType of Prometheus text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Labels pairs of name and value
+type Labels []string
+
+// L returns Labels of name and value pairs
+func L(pairs ...string) Labels {
+	return Labels(pairs)
+}
+
+// Collector writes metric families, samples of a family must follow its header
+type Collector interface {
+	Collect(w *Writer)
+}
+
+// Writer writes metrics in Prometheus text format, the first error is kept in Err
+type Writer struct {
+	bw  *bufio.Writer
+	n   int64
+	err error
+}
+
+// NewWriter ...
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{bw: bufio.NewWriter(w)}
+}
+
+// Header writes HELP and TYPE of a family
+func (w *Writer) Header(name, typ, help string) {
+	w.write("# HELP " + name + " " + escapeHelp(help) + "\n")
+	w.write("# TYPE " + name + " " + typ + "\n")
+}
+
+// Sample writes a sample of counter or gauge
+func (w *Writer) Sample(name string, labels Labels, value float64) {
+	w.write(name + formatLabels(labels, "", "") + " " + formatFloat(value) + "\n")
+}
+
+// Histogram writes samples of a histogram, counts[i] is number in (bounds[i-1], bounds[i]],
+// and the last of counts is number over all bounds
+func (w *Writer) Histogram(name string, labels Labels, bounds []time.Duration, counts []uint64, sum time.Duration) {
+	var cum uint64
+	for i, b := range bounds {
+		if i < len(counts) {
+			cum += counts[i]
+		}
+		w.write(name + "_bucket" + formatLabels(labels, "le", formatFloat(b.Seconds())) + " " + strconv.FormatUint(cum, 10) + "\n")
+	}
+	if len(counts) > len(bounds) {
+		cum += counts[len(bounds)]
+	}
+	w.write(name + "_bucket" + formatLabels(labels, "le", "+Inf") + " " + strconv.FormatUint(cum, 10) + "\n")
+	w.write(name + "_sum" + formatLabels(labels, "", "") + " " + formatFloat(sum.Seconds()) + "\n")
+	w.write(name + "_count" + formatLabels(labels, "", "") + " " + strconv.FormatUint(cum, 10) + "\n")
+}
+
+// Flush ...
+func (w *Writer) Flush() error {
+	if w.err == nil {
+		w.err = w.bw.Flush()
+	}
+	return w.err
+}
+
+// Err returns the first error of writing
+func (w *Writer) Err() error {
+	return w.err
+}
+
+func (w *Writer) write(s string) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.bw.WriteString(s)
+	w.n += int64(n)
+	w.err = err
+}
+
+func formatLabels(labels Labels, extName, extValue string) string {
+	if len(labels) < 2 && extName == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	sep := ""
+	for i := 0; i+1 < len(labels); i += 2 {
+		sb.WriteString(sep + labels[i] + `="` + escapeLabel(labels[i+1]) + `"`)
+		sep = ","
+	}
+	if extName != "" {
+		sb.WriteString(sep + extName + `="` + extValue + `"`)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Header("test_total", TypeCounter, "Test\\ of\nhelp.")
+	w.Sample("test_total", L("addr", `ldap://"a"`), 3)
+	w.Sample("test_total", nil, 0.5)
+	w.Header("test_seconds", TypeHistogram, "Test histogram.")
+	w.Histogram("test_seconds", L("op", "bind"), []time.Duration{time.Millisecond, time.Second}, []uint64{1, 2, 3}, 1500*time.Millisecond)
+	assert.NoError(t, w.Flush())
+
+	want := `# HELP test_total Test\\ of\nhelp.
+# TYPE test_total counter
+test_total{addr="ldap://\"a\""} 3
+test_total 0.5
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{op="bind",le="0.001"} 1
+test_seconds_bucket{op="bind",le="1"} 3
+test_seconds_bucket{op="bind",le="+Inf"} 6
+test_seconds_sum{op="bind"} 1.5
+test_seconds_count{op="bind"} 6
+`
+	assert.Equal(t, want, buf.String())
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.Observe("search", "ldap://b", 2*time.Millisecond, nil)
+	r.Observe("bind", "ldap://a", time.Millisecond, nil)
+	r.Observe("bind", "ldap://a", 20*time.Second, ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("bad")))
+	r.Observe("bind", "ldap://a", time.Second, errors.New("other"))
+	r.Register(collectorFunc(func(w *Writer) {
+		w.Header("extra", TypeGauge, "Extra.")
+		w.Sample("extra", nil, 1)
+	}))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+	out := rec.Body.String()
+	for _, line := range []string{
+		`staffio_ldap_operations_total{op="bind",addr="ldap://a"} 3`,
+		`staffio_ldap_operations_total{op="search",addr="ldap://b"} 1`,
+		`staffio_ldap_errors_total{op="bind",addr="ldap://a",code="49"} 1`,
+		`staffio_ldap_errors_total{op="bind",addr="ldap://a",code="other"} 1`,
+		`staffio_ldap_operation_duration_seconds_bucket{op="bind",addr="ldap://a",le="0.001"} 1`,
+		`staffio_ldap_operation_duration_seconds_bucket{op="bind",addr="ldap://a",le="5"} 2`,
+		`staffio_ldap_operation_duration_seconds_bucket{op="bind",addr="ldap://a",le="+Inf"} 3`,
+		`staffio_ldap_operation_duration_seconds_sum{op="bind",addr="ldap://a"} 21.001`,
+		"extra 1",
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+	assert.True(t, strings.Index(out, `op="bind"`) < strings.Index(out, `op="search"`), "sorted")
+	assert.Equal(t, 1, strings.Count(out, "# TYPE staffio_ldap_errors_total"))
+
+	var buf bytes.Buffer
+	n, err := NewRegistry().WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+type collectorFunc func(w *Writer)
+
+func (f collectorFunc) Collect(w *Writer) {
+	f(w)
+}
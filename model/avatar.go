@@ -0,0 +1,373 @@
+package model
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/liut/staffio-backend/photo"
+)
+
+// AvatarResolver returns the URI of avatar of people in size pixels, 0 for the default size,
+// ok is false if the people is not matched
+type AvatarResolver interface {
+	Resolve(u *People, size int) (uri string, ok bool)
+}
+
+// AvatarResolverFunc ...
+type AvatarResolverFunc func(u *People, size int) (string, bool)
+
+// Resolve ...
+func (f AvatarResolverFunc) Resolve(u *People, size int) (string, bool) {
+	return f(u, size)
+}
+
+// DefaultAvatarResolvers returns built-ins of a full URI, QQ and WeCom, a path as is and the jpegPhoto
+func DefaultAvatarResolvers() []AvatarResolver {
+	return []AvatarResolver{
+		URLResolver{},
+		&PrefixResolver{Prefixes: []string{"/bizmail", "/wwhead"}, Base: URIPrefixQqcn},
+		&PrefixResolver{Prefixes: []string{"/wwpic/"}, Base: URIPrefixWxcn},
+		&PathResolver{},
+		PhotoResolver{},
+	}
+}
+
+var avatarResolvers atomic.Pointer[[]AvatarResolver]
+
+func init() {
+	SetAvatarResolvers()
+}
+
+// SetAvatarResolvers sets resolvers tried in order, none resets to DefaultAvatarResolvers
+func SetAvatarResolvers(rs ...AvatarResolver) {
+	if len(rs) == 0 {
+		rs = DefaultAvatarResolvers()
+	}
+	avatarResolvers.Store(&rs)
+}
+
+// RegisterAvatarResolver appends r, tried after the resolvers set
+func RegisterAvatarResolver(r AvatarResolver) {
+	for {
+		old := avatarResolvers.Load()
+		rs := append(append([]AvatarResolver{}, *old...), r)
+		if avatarResolvers.CompareAndSwap(old, &rs) {
+			return
+		}
+	}
+}
+
+// GetAvatarResolvers ...
+func GetAvatarResolvers() []AvatarResolver {
+	return *avatarResolvers.Load()
+}
+
+// AvatarURI make uri of avatar in the default size
+func (u *People) AvatarURI() string {
+	return u.AvatarURIOf(0)
+}
+
+// AvatarURIOf returns uri of avatar in size pixels by the first resolver matched, empty if none
+func (u *People) AvatarURIOf(size int) string {
+	for _, r := range GetAvatarResolvers() {
+		if uri, ok := r.Resolve(u, size); ok {
+			return uri
+		}
+	}
+	return ""
+}
+
+// URLResolver matches a full URI of avatarPath, as http, https, data or //
+type URLResolver struct{}
+
+// Resolve ...
+func (URLResolver) Resolve(u *People, size int) (string, bool) {
+	s := u.AvatarPath
+	if strings.HasPrefix(s, "//") || strings.HasPrefix(s, "http:") || strings.HasPrefix(s, "https:") ||
+		strings.HasPrefix(s, "data:") {
+		if strings.HasSuffix(s, "/") {
+			s += "0"
+		}
+		return s, true
+	}
+	return "", false
+}
+
+// qqSizes sizes of QQ and WeCom avatars, 0 is the original
+var qqSizes = []int{40, 60, 100, 140}
+
+// PrefixResolver matches avatarPath of a prefix, like QQ and WeCom,
+// the last segment 0 (or empty) is replaced with the size, 60 by default
+type PrefixResolver struct {
+	Prefixes []string
+	Base     string
+}
+
+// Resolve ...
+func (r *PrefixResolver) Resolve(u *People, size int) (string, bool) {
+	s := u.AvatarPath
+	for _, prefix := range r.Prefixes {
+		if !strings.HasPrefix(s, prefix) {
+			continue
+		}
+		if strings.HasSuffix(s, "/") {
+			s += "0"
+		}
+		if strings.HasSuffix(s, "/0") {
+			s = s[:len(s)-1] + strconv.Itoa(qqSize(size))
+		}
+		return r.Base + s, true
+	}
+	return "", false
+}
+
+// qqSize returns the smallest size not less than size, 0 if larger than all
+func qqSize(size int) int {
+	if size <= 0 {
+		return 60
+	}
+	for _, n := range qqSizes {
+		if n >= size {
+			return n
+		}
+	}
+	return 0
+}
+
+// PathResolver matches any avatarPath, joined to Base such as a CDN, as is if Base is empty.
+// A path ending with / gets 0 appended, the original size of QQ and WeCom
+type PathResolver struct {
+	Base string
+	// SizeParam query parameter of size, such as "w" for ?w=96, none if empty
+	SizeParam string
+}
+
+// Resolve ...
+func (r *PathResolver) Resolve(u *People, size int) (string, bool) {
+	s := u.AvatarPath
+	if s == "" {
+		return "", false
+	}
+	if strings.HasSuffix(s, "/") {
+		s += "0"
+	}
+	if r.Base != "" {
+		s = strings.TrimSuffix(r.Base, "/") + "/" + strings.TrimPrefix(s, "/")
+	}
+	if r.SizeParam != "" && size > 0 {
+		sep := "?"
+		if strings.Contains(s, "?") {
+			sep = "&"
+		}
+		s += sep + url.QueryEscape(r.SizeParam) + "=" + strconv.Itoa(size)
+	}
+	return s, true
+}
+
+// PhotoResolver matches the jpegPhoto, as a data URI of a thumbnail if size > 0,
+// thumbnails are cached by hash of the photo and size
+type PhotoResolver struct{}
+
+// Resolve ...
+func (PhotoResolver) Resolve(u *People, size int) (string, bool) {
+	if len(u.JpegPhoto) == 0 {
+		return "", false
+	}
+	data := u.JpegPhoto
+	if size <= 0 {
+		uri := photo.DataURI(data)
+		return uri, uri != ""
+	}
+	key := thumbKey{sum: sha256.Sum256(data), size: size}
+	if uri, ok := thumbs.get(key); ok {
+		return uri, uri != ""
+	}
+	if thumb, err := photo.Thumbnail(data, size); err == nil {
+		data = thumb
+	}
+	uri := photo.DataURI(data)
+	thumbs.put(key, uri)
+	return uri, uri != ""
+}
+
+// thumbCacheSize max thumbnails cached by PhotoResolver
+const thumbCacheSize = 256
+
+var thumbs = newThumbCache(thumbCacheSize)
+
+type thumbKey struct {
+	sum  [sha256.Size]byte
+	size int
+}
+
+type thumbEntry struct {
+	key thumbKey
+	uri string
+}
+
+// thumbCache data URIs of thumbnails, the least recently used is evicted
+type thumbCache struct {
+	mu    sync.Mutex
+	max   int
+	ll    *list.List
+	items map[thumbKey]*list.Element
+}
+
+func newThumbCache(max int) *thumbCache {
+	return &thumbCache{max: max, ll: list.New(), items: make(map[thumbKey]*list.Element)}
+}
+
+func (c *thumbCache) get(key thumbKey) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		return e.Value.(*thumbEntry).uri, true
+	}
+	return "", false
+}
+
+func (c *thumbCache) put(key thumbKey, uri string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*thumbEntry).uri = uri
+		return
+	}
+	c.items[key] = c.ll.PushFront(&thumbEntry{key: key, uri: uri})
+	for c.ll.Len() > c.max {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*thumbEntry).key)
+	}
+}
+
+// DefaultGravatarBase ...
+const DefaultGravatarBase = "https://gravatar.com/avatar/"
+
+// GravatarResolver matches an email, by the SHA-256 hash of it
+type GravatarResolver struct {
+	Base string // default DefaultGravatarBase
+	// Default image of Gravatar if none, such as identicon, mp or 404
+	Default string
+}
+
+// Resolve ...
+func (r *GravatarResolver) Resolve(u *People, size int) (string, bool) {
+	email := strings.ToLower(strings.TrimSpace(u.Email))
+	if email == "" {
+		return "", false
+	}
+	base := r.Base
+	if base == "" {
+		base = DefaultGravatarBase
+	}
+	sum := sha256.Sum256([]byte(email))
+	q := url.Values{}
+	if size > 0 {
+		q.Set("s", strconv.Itoa(size))
+	}
+	if r.Default != "" {
+		q.Set("d", r.Default)
+	}
+	uri := base + hex.EncodeToString(sum[:])
+	if len(q) > 0 {
+		uri += "?" + q.Encode()
+	}
+	return uri, true
+}
+
+// styles of FallbackResolver
+const (
+	AvatarInitials  = "initials"
+	AvatarIdenticon = "identicon"
+)
+
+// FallbackResolver matches any people, an SVG data URI of initials of the name or an identicon of the uid
+type FallbackResolver struct {
+	Style string // default AvatarInitials
+}
+
+// Resolve ...
+func (r *FallbackResolver) Resolve(u *People, size int) (string, bool) {
+	if size <= 0 {
+		size = photo.DefaultThumbSize
+	}
+	sum := sha256.Sum256([]byte(u.UID))
+	// hue of background from the hash
+	color := fmt.Sprintf("hsl(%d,55%%,50%%)", int(sum[0])*360/256)
+	var svg string
+	if r.Style == AvatarIdenticon {
+		svg = identicon(sum, color, size)
+	} else {
+		svg = initialsSVG(initials(u), color, size)
+	}
+	return "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(svg)), true
+}
+
+// initials returns the first characters of given name and surname, or the first of the name
+func initials(u *People) string {
+	if u.GivenName != "" && u.Surname != "" && isLatin(u.GivenName+u.Surname) {
+		return strings.ToUpper(Initial(u.GivenName) + Initial(u.Surname))
+	}
+	name := []rune(u.Name())
+	if len(name) == 0 {
+		return "?"
+	}
+	if unicode.Is(unicode.Han, name[0]) && len(name) > 1 {
+		// the given name of Chinese, after the surname
+		return string(name[len(name)-min(2, len(name)-1):])
+	}
+	return strings.ToUpper(string(name[0]))
+}
+
+func isLatin(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxLatin1 {
+			return false
+		}
+	}
+	return true
+}
+
+func initialsSVG(text, color string, size int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 100 100">`, size, size)
+	fmt.Fprintf(&sb, `<rect width="100" height="100" fill="%s"/>`, color)
+	sb.WriteString(`<text x="50" y="50" dy=".35em" fill="#fff" font-family="sans-serif" font-size="40" text-anchor="middle">`)
+	xmlEscaper.WriteString(&sb, text)
+	sb.WriteString(`</text></svg>`)
+	return sb.String()
+}
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// identicon a symmetric 5x5 grid of the hash
+func identicon(sum [sha256.Size]byte, color string, size int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 5 5" shape-rendering="crispEdges">`, size, size)
+	sb.WriteString(`<rect width="5" height="5" fill="#f0f0f0"/>`)
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 3; x++ {
+			if sum[1+y*3+x]&1 == 0 {
+				continue
+			}
+			fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="1" height="1" fill="%s"/>`, x, y, color)
+			if x < 2 {
+				fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="1" height="1" fill="%s"/>`, 4-x, y, color)
+			}
+		}
+	}
+	sb.WriteString(`</svg>`)
+	return sb.String()
+}
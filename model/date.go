@@ -0,0 +1,133 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalidDate ...
+var ErrInvalidDate = errors.New("invalid date")
+
+// layouts of Date
+const (
+	DateLayoutLDAP = "20060102"
+	DateLayoutISO  = "2006-01-02"
+)
+
+// legacy layouts parsed leniently, after normalized separators
+var dateLayouts = []string{
+	DateLayoutLDAP,
+	DateLayoutISO,
+	"2006-1-2",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+var dateSeparators = strings.NewReplacer("/", "-", ".", "-")
+
+// Date a day as a string, YYYYMMDD in LDAP and ISO 8601 in JSON,
+// a value not parsed is kept as is
+type Date string
+
+// NewDate ...
+func NewDate(t time.Time) Date {
+	return Date(t.Format(DateLayoutLDAP))
+}
+
+// ParseDate parses s leniently, as 20060102, 2006-01-02, 2006/1/2, 2006.01.02 or RFC 3339
+func ParseDate(s string) (Date, error) {
+	t, err := Date(s).Time()
+	if err != nil {
+		return "", err
+	}
+	return NewDate(t), nil
+}
+
+// Time returns the day at midnight in UTC
+func (d Date) Time() (time.Time, error) {
+	s := dateSeparators.Replace(strings.TrimSpace(string(d)))
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			y, m, day := t.Date()
+			return time.Date(y, m, day, 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, ErrInvalidDate
+}
+
+// IsZero ...
+func (d Date) IsZero() bool {
+	return strings.TrimSpace(string(d)) == ""
+}
+
+// Valid reports whether d is empty or parsed
+func (d Date) Valid() bool {
+	if d.IsZero() {
+		return true
+	}
+	_, err := d.Time()
+	return err == nil
+}
+
+// LDAP returns YYYYMMDD, or d as is if not parsed
+func (d Date) LDAP() string {
+	if t, err := d.Time(); err == nil {
+		return t.Format(DateLayoutLDAP)
+	}
+	return string(d)
+}
+
+// ISO returns YYYY-MM-DD, or d as is if not parsed
+func (d Date) ISO() string {
+	if t, err := d.Time(); err == nil {
+		return t.Format(DateLayoutISO)
+	}
+	return string(d)
+}
+
+// Month returns 0 if not parsed
+func (d Date) Month() time.Month {
+	if t, err := d.Time(); err == nil {
+		return t.Month()
+	}
+	return 0
+}
+
+// MarshalJSON as ISO 8601
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.ISO())
+}
+
+// UnmarshalJSON leniently, normalized to YYYYMMDD if parsed
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*d = Date(Date(s).LDAP())
+	return nil
+}
+
+// DateRange of days, inclusive, an empty end is open
+type DateRange struct {
+	From Date `json:"from,omitempty"`
+	To   Date `json:"to,omitempty"`
+}
+
+// Contains reports whether d is in the range, false if d is not parsed
+func (r *DateRange) Contains(d Date) bool {
+	if d.IsZero() || !d.Valid() {
+		return false
+	}
+	v := d.LDAP()
+	if !r.From.IsZero() && v < r.From.LDAP() {
+		return false
+	}
+	if !r.To.IsZero() && v > r.To.LDAP() {
+		return false
+	}
+	return true
+}
@@ -5,11 +5,13 @@ type Group struct {
 	Name        string   `json:"name"`
 	Description string   `json:"description"`
 	Members     []string `json:"members"`
+	// Version token of the entry, an update with it fails with a conflict if the entry was changed since read
+	Version string `json:"version,omitempty"`
 }
 
 // vars
 var (
-	EmptyGroup = &Group{"", "", make([]string, 0)}
+	EmptyGroup = &Group{Members: make([]string, 0)}
 )
 
 // Has ..
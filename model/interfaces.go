@@ -1,12 +1,40 @@
 package model
 
+import (
+	"errors"
+	"time"
+)
+
 // Spec param of searching
 type Spec struct {
 	Name   string   `json:"name,omitempty"`
 	Email  string   `json:"email"`
 	Mobile string   `json:"mobile"`
+	IDCN   string   `json:"idcn,omitempty"` // exact match, by the blind index if sealed
 	UIDs   []string `json:"uids,omitempty"`
 	Limit  int      `json:"limit,omitempty"`
+
+	Birthday   *DateRange `json:"birthday,omitempty"`
+	JoinDate   *DateRange `json:"joinDate,omitempty"`
+	BirthMonth time.Month `json:"birthMonth,omitempty"` // birthdays in the month of any year, such as time.Now().Month()
+
+	InactiveSince *time.Time `json:"inactiveSince,omitempty"` // no login since the time, or never logged in
+
+	SkipPhoto bool `json:"skipPhoto,omitempty"` // not load jpegPhoto
+}
+
+// MatchDates reports whether dates of the people match the spec
+func (s *Spec) MatchDates(u *People) bool {
+	if s.Birthday != nil && !s.Birthday.Contains(u.Birthday) {
+		return false
+	}
+	if s.JoinDate != nil && !s.JoinDate.Contains(u.JoinDate) {
+		return false
+	}
+	if s.BirthMonth > 0 && u.Birthday.Month() != s.BirthMonth {
+		return false
+	}
+	return true
 }
 
 // PeopleStore Storage for People
@@ -33,6 +61,9 @@ type PasswordStore interface {
 	PasswordReset(uid, newPassword string) error
 }
 
+// ErrLogin incorrect uid or password, returned by Authenticator
+var ErrLogin = errors.New("Incorrect Username/Password")
+
 // Authenticator for Authenticate
 type Authenticator interface {
 	// Authenticate with uid and password
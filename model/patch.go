@@ -0,0 +1,152 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// nolint
+var (
+	ErrPatchUnknownField = errors.New("unknown field of people patch")
+	ErrPatchInvalidValue = errors.New("invalid value of people patch")
+)
+
+// PeoplePatch partial changes of People, a nil field is unchanged, a pointer to "" clears the field
+type PeoplePatch struct {
+	CommonName     *string `json:"cn,omitempty"`
+	GivenName      *string `json:"gn,omitempty"`
+	Surname        *string `json:"sn,omitempty"`
+	Nickname       *string `json:"nickname,omitempty"`
+	Birthday       *string `json:"birthday,omitempty"`
+	Gender         *string `json:"gender,omitempty"`
+	Email          *string `json:"email,omitempty"`
+	Mobile         *string `json:"mobile,omitempty"`
+	EmployeeNumber *string `json:"eid,omitempty"`
+	EmployeeType   *string `json:"etype,omitempty"`
+	AvatarPath     *string `json:"avatarPath,omitempty"`
+	Description    *string `json:"description,omitempty"`
+	JoinDate       *string `json:"joinDate,omitempty"`
+	IDCN           *string `json:"idcn,omitempty"`
+
+	// Version expected version of People, empty to skip the check
+	Version string `json:"version,omitempty"`
+}
+
+// patchField a field of PeoplePatch and People by JSON name
+type patchField struct {
+	name   string
+	patch  func(p *PeoplePatch) **string
+	people func(u *People) *string
+}
+
+var patchFields = []patchField{
+	{"cn", func(p *PeoplePatch) **string { return &p.CommonName }, func(u *People) *string { return &u.CommonName }},
+	{"gn", func(p *PeoplePatch) **string { return &p.GivenName }, func(u *People) *string { return &u.GivenName }},
+	{"sn", func(p *PeoplePatch) **string { return &p.Surname }, func(u *People) *string { return &u.Surname }},
+	{"nickname", func(p *PeoplePatch) **string { return &p.Nickname }, func(u *People) *string { return &u.Nickname }},
+	{"birthday", func(p *PeoplePatch) **string { return &p.Birthday }, func(u *People) *string { return (*string)(&u.Birthday) }},
+	{"gender", func(p *PeoplePatch) **string { return &p.Gender }, func(u *People) *string { return &u.Gender }},
+	{"email", func(p *PeoplePatch) **string { return &p.Email }, func(u *People) *string { return &u.Email }},
+	{"mobile", func(p *PeoplePatch) **string { return &p.Mobile }, func(u *People) *string { return &u.Mobile }},
+	{"eid", func(p *PeoplePatch) **string { return &p.EmployeeNumber }, func(u *People) *string { return &u.EmployeeNumber }},
+	{"etype", func(p *PeoplePatch) **string { return &p.EmployeeType }, func(u *People) *string { return &u.EmployeeType }},
+	{"avatarPath", func(p *PeoplePatch) **string { return &p.AvatarPath }, func(u *People) *string { return &u.AvatarPath }},
+	{"description", func(p *PeoplePatch) **string { return &p.Description }, func(u *People) *string { return &u.Description }},
+	{"joinDate", func(p *PeoplePatch) **string { return &p.JoinDate }, func(u *People) *string { return (*string)(&u.JoinDate) }},
+	{"idcn", func(p *PeoplePatch) **string { return &p.IDCN }, func(u *People) *string { return &u.IDCN }},
+}
+
+func findPatchField(name string) (patchField, bool) {
+	for _, f := range patchFields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return patchField{}, false
+}
+
+// Set sets field of JSON name to value, an empty value clears it
+func (p *PeoplePatch) Set(name, value string) error {
+	f, ok := findPatchField(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrPatchUnknownField, name)
+	}
+	*f.patch(p) = &value
+	return nil
+}
+
+// Clear clears field of JSON name
+func (p *PeoplePatch) Clear(name string) error {
+	return p.Set(name, "")
+}
+
+// Get returns value of field of JSON name, ok is false if unchanged
+func (p *PeoplePatch) Get(name string) (value string, ok bool) {
+	if f, found := findPatchField(name); found {
+		if v := *f.patch(p); v != nil {
+			return *v, true
+		}
+	}
+	return "", false
+}
+
+// Fields returns JSON names of changed fields, sorted
+func (p *PeoplePatch) Fields() []string {
+	var names []string
+	for _, f := range patchFields {
+		if *f.patch(p) != nil {
+			names = append(names, f.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsEmpty reports whether nothing is changed
+func (p *PeoplePatch) IsEmpty() bool {
+	return len(p.Fields()) == 0
+}
+
+// Apply applies changes to u
+func (p *PeoplePatch) Apply(u *People) {
+	for _, f := range patchFields {
+		if v := *f.patch(p); v != nil {
+			*f.people(u) = *v
+		}
+	}
+}
+
+// DecodeMergePatch decodes a JSON Merge Patch (RFC 7396) of People, a null clears the field,
+// a field must be a string or null
+func DecodeMergePatch(data []byte) (*PeoplePatch, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPatchInvalidValue, err)
+	}
+	p := new(PeoplePatch)
+	for name, raw := range m {
+		if name == "version" {
+			if err := json.Unmarshal(raw, &p.Version); err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrPatchInvalidValue, name)
+			}
+			continue
+		}
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			if err := p.Clear(name); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrPatchInvalidValue, name)
+		}
+		if err := p.Set(name, s); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
@@ -1,7 +1,6 @@
 package model
 
 import (
-	"encoding/base64"
 	"strings"
 	"time"
 )
@@ -9,8 +8,6 @@ import (
 // nolint
 var (
 	cnFormat = "<gn> <sn>"
-
-	avatarReplacer = strings.NewReplacer("/0", "/60")
 )
 
 // consts
@@ -32,7 +29,7 @@ type People struct {
 	GivenName      string `json:"gn" form:"gn" binding:"required"`          // 名 FirstName
 	Surname        string `json:"sn" form:"sn" binding:"required"`          // 姓 LastName
 	Nickname       string `json:"nickname,omitempty" form:"nickname"`       // 昵称
-	Birthday       string `json:"birthday,omitempty" form:"birthday"`       // 生日
+	Birthday       Date   `json:"birthday,omitempty" form:"birthday"`       // 生日
 	Gender         string `json:"gender,omitempty" form:"gender"`           // 性别: M F U
 	Email          string `json:"email" form:"email" binding:"required"`    // 邮箱
 	Mobile         string `json:"mobile" form:"mobile" binding:"required"`  // 手机
@@ -42,7 +39,7 @@ type People struct {
 	AvatarPath     string `json:"avatarPath,omitempty" form:"avatar"`       // 头像
 	JpegPhoto      []byte `json:"-" form:"-"`                               // jpegPhoto data
 	Description    string `json:"description,omitempty" form:"description"` // 描述
-	JoinDate       string `json:"joinDate,omitempty" form:"joinDate"`       // 加入日期
+	JoinDate       Date   `json:"joinDate,omitempty" form:"joinDate"`       // 加入日期
 	IDCN           string `json:"idcn,omitempty" form:"idcn"`               // 身份证号
 
 	Organization  string `json:"org,omitempty" form:"org"`   // 所属组织
@@ -51,8 +48,12 @@ type People struct {
 	Created  *time.Time `json:"created,omitempty" form:"-"`  // 创建时间
 	Modified *time.Time `json:"modified,omitempty" form:"-"` // 修改时间
 
-	DN string `json:"dn,omitempty" form:"-"` // distinguishedName of LDAP entry
+	LastLogin  *time.Time `json:"lastLogin,omitempty" form:"-"`  // 最后登录时间
+	LogonCount int        `json:"logonCount,omitempty" form:"-"` // 登录次数
 
+	DN string `json:"dn,omitempty" form:"-"` // distinguishedName of LDAP entry
+	// Version token of the entry, an update with it fails with a conflict if the entry was changed since read
+	Version string `json:"version,omitempty" form:"version"`
 }
 
 // GetUID ...
@@ -91,31 +92,6 @@ func (u *People) GetCommonName() string {
 	return formatCN(u.GivenName, u.Surname)
 }
 
-// AvatarURI make uri of avatar
-func (u *People) AvatarURI() string {
-	if len(u.AvatarPath) > 0 {
-		s := u.AvatarPath
-		if strings.HasSuffix(s, "/") {
-			s = s + "0"
-		}
-		if strings.HasPrefix(s, "//") || strings.HasPrefix(s, "http") { // full uri
-			return s
-		}
-		if strings.HasPrefix(s, "/bizmail") || strings.HasPrefix(s, "/wwhead") { // qq & wechat avatar
-			return URIPrefixQqcn + avatarReplacer.Replace(s)
-		}
-		if strings.HasPrefix(s, "/wwpic/") { // wechat avatar
-			return URIPrefixWxcn + avatarReplacer.Replace(s)
-		}
-		// TODO: show uri
-		return s
-	}
-	if len(u.JpegPhoto) > 0 {
-		return URIPrefixData + base64.URLEncoding.EncodeToString(u.JpegPhoto)
-	}
-	return ""
-}
-
 func formatCN(gn, sn string) string {
 	r := strings.NewReplacer("<gn>", gn, "<sn>", sn)
 	return r.Replace(cnFormat)
@@ -156,7 +132,7 @@ func NewPeople(args ...string) *People {
 	obj := &People{
 		UID:        args[0],
 		CommonName: args[0],
-		Surname:    args[0][0:1],
+		Surname:    Initial(args[0]),
 	}
 	if argc > 1 {
 		obj.CommonName = args[1]
@@ -169,7 +145,7 @@ func NewPeople(args ...string) *People {
 				}
 			}
 		} else {
-			obj.Surname = args[1][0:1]
+			obj.Surname = Initial(args[1])
 		}
 	}
 
@@ -0,0 +1,128 @@
+package model
+
+import (
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Sensitivity of a People field in logs
+type Sensitivity int
+
+// levels of sensitivity
+const (
+	SensitivityPublic  Sensitivity = iota // logged as is
+	SensitivityPrivate                    // masked, keeps the last 4 characters
+	SensitivitySecret                     // replaced with Redacted
+)
+
+// Redacted replaces the value of a secret field in logs and audit events
+const Redacted = "[REDACTED]"
+
+// LogPolicy sensitivity of People fields by their JSON names, unlisted fields are public
+type LogPolicy struct {
+	Fields map[string]Sensitivity
+	// Unredacted logs full values, for debugging only
+	Unredacted bool
+}
+
+// DefaultLogPolicy hides personal data, the jpegPhoto is always logged as its size
+var DefaultLogPolicy = &LogPolicy{
+	Fields: map[string]Sensitivity{
+		"email":    SensitivityPrivate,
+		"mobile":   SensitivityPrivate,
+		"tel":      SensitivityPrivate,
+		"birthday": SensitivitySecret,
+		"idcn":     SensitivitySecret,
+	},
+}
+
+var logPolicy atomic.Pointer[LogPolicy]
+
+func init() {
+	logPolicy.Store(DefaultLogPolicy)
+}
+
+// SetLogPolicy sets the policy of People in logs, nil resets to DefaultLogPolicy
+func SetLogPolicy(p *LogPolicy) {
+	if p == nil {
+		p = DefaultLogPolicy
+	}
+	logPolicy.Store(p)
+}
+
+// GetLogPolicy ...
+func GetLogPolicy() *LogPolicy {
+	return logPolicy.Load()
+}
+
+// Redact returns value of field in logs by the policy
+func (p *LogPolicy) Redact(field, value string) string {
+	if p.Unredacted || value == "" {
+		return value
+	}
+	switch p.Fields[field] {
+	case SensitivityPrivate:
+		return mask(value)
+	case SensitivitySecret:
+		return Redacted
+	}
+	return value
+}
+
+func mask(s string) string {
+	n := utf8.RuneCountInString(s)
+	if n <= 4 {
+		return "****"
+	}
+	r := []rune(s)
+	return "****" + string(r[n-4:])
+}
+
+// LogValue implements slog.LogValuer, fields are redacted by the policy of SetLogPolicy
+func (u People) LogValue() slog.Value {
+	p := GetLogPolicy()
+	attrs := make([]slog.Attr, 0, 12)
+	add := func(field, value string) {
+		if value != "" {
+			attrs = append(attrs, slog.String(field, p.Redact(field, value)))
+		}
+	}
+	add("uid", u.UID)
+	add("cn", u.CommonName)
+	add("gn", u.GivenName)
+	add("sn", u.Surname)
+	add("nickname", u.Nickname)
+	add("birthday", u.Birthday.ISO())
+	add("gender", u.Gender)
+	add("email", u.Email)
+	add("mobile", u.Mobile)
+	add("tel", u.Tel)
+	add("eid", u.EmployeeNumber)
+	add("etype", u.EmployeeType)
+	add("avatarPath", u.AvatarPath)
+	if len(u.JpegPhoto) > 0 {
+		attrs = append(attrs, slog.String("jpegPhoto", strconv.Itoa(len(u.JpegPhoto))+" bytes"))
+	}
+	add("description", u.Description)
+	add("joinDate", u.JoinDate.ISO())
+	add("idcn", u.IDCN)
+	add("org", u.Organization)
+	add("dept", u.OrgDepartment)
+	if u.Created != nil {
+		add("created", u.Created.Format(time.RFC3339))
+	}
+	if u.Modified != nil {
+		add("modified", u.Modified.Format(time.RFC3339))
+	}
+	if u.LastLogin != nil {
+		add("lastLogin", u.LastLogin.Format(time.RFC3339))
+	}
+	if u.LogonCount > 0 {
+		add("logonCount", strconv.Itoa(u.LogonCount))
+	}
+	add("dn", u.DN)
+	return slog.GroupValue(attrs...)
+}
@@ -0,0 +1,281 @@
+package model
+
+import (
+	"errors"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// UIDPattern of a valid uid
+const UIDPattern = "^[a-z][a-z0-9-_]+$"
+
+// ErrInvalidPeople matches a *ValidationError with errors.Is
+var ErrInvalidPeople = errors.New("invalid people")
+
+// rules of validation
+const (
+	RuleRequired = "required"
+	RuleFormat   = "format"
+	RuleDate     = "date"
+	RuleChecksum = "checksum"
+)
+
+// DefaultRegion calling code of a mobile number without the + prefix
+const DefaultRegion = "86"
+
+// DefaultMobileRules national numbers of mobile by calling code, other regions are checked as E.164 only
+var DefaultMobileRules = map[string]*regexp.Regexp{
+	"1":   regexp.MustCompile(`^[2-9]\d{2}[2-9]\d{6}$`),
+	"44":  regexp.MustCompile(`^7\d{9}$`),
+	"65":  regexp.MustCompile(`^[89]\d{7}$`),
+	"81":  regexp.MustCompile(`^[789]0\d{8}$`),
+	"86":  regexp.MustCompile(`^1[3-9]\d{9}$`),
+	"852": regexp.MustCompile(`^[4-9]\d{7}$`),
+	"853": regexp.MustCompile(`^6\d{7}$`),
+	"886": regexp.MustCompile(`^9\d{8}$`),
+}
+
+var (
+	reUID   = regexp.MustCompile(UIDPattern)
+	reE164  = regexp.MustCompile(`^\+[1-9]\d{6,14}$`)
+	reDigit = regexp.MustCompile(`^\d+$`)
+	reDate  = regexp.MustCompile(`^\d{8}$`)
+
+	mobileStripper = strings.NewReplacer(" ", "", "-", "")
+)
+
+// FieldError a failed rule of a field by JSON name
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field, matches ErrInvalidPeople with errors.Is
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		fields[i] = fe.Field
+	}
+	return ErrInvalidPeople.Error() + ": " + strings.Join(fields, ", ")
+}
+
+// Is ...
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidPeople
+}
+
+// Has reports whether field is invalid
+func (e *ValidationError) Has(field string) bool {
+	for _, fe := range e.Errors {
+		if fe.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *ValidationError) add(field, rule, message string) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Rule: rule, Message: message})
+}
+
+// Validator of People, zero value uses the defaults
+type Validator struct {
+	// UID pattern, default UIDPattern
+	UID *regexp.Regexp
+	// Required fields by JSON name, default uid and sn
+	Required []string
+	// Region calling code of a mobile without the + prefix, default DefaultRegion
+	Region string
+	// MobileRules national numbers by calling code, default DefaultMobileRules
+	MobileRules map[string]*regexp.Regexp
+}
+
+// Validate checks the people, return *ValidationError if any field is invalid
+func (v *Validator) Validate(u *People) error {
+	if u == nil {
+		return &ValidationError{Errors: []FieldError{{Field: "uid", Rule: RuleRequired, Message: "uid is required"}}}
+	}
+	ve := new(ValidationError)
+	required := v.Required
+	if required == nil {
+		required = []string{"uid", "sn"}
+	}
+	values := map[string]string{
+		"uid": u.UID, "cn": u.CommonName, "gn": u.GivenName, "sn": u.Surname,
+		"nickname": u.Nickname, "email": u.Email, "mobile": u.Mobile, "tel": u.Tel,
+		"eid": u.EmployeeNumber, "etype": u.EmployeeType, "birthday": string(u.Birthday),
+		"gender": u.Gender, "joinDate": string(u.JoinDate), "idcn": u.IDCN,
+	}
+	for _, field := range required {
+		if strings.TrimSpace(values[field]) == "" {
+			ve.add(field, RuleRequired, field+" is required")
+		}
+	}
+
+	reU := v.UID
+	if reU == nil {
+		reU = reUID
+	}
+	if u.UID != "" && !reU.MatchString(u.UID) {
+		ve.add("uid", RuleFormat, "uid must match "+reU.String())
+	}
+	if u.Email != "" && !validEmail(u.Email) {
+		ve.add("email", RuleFormat, "email is not a valid address")
+	}
+	if u.Mobile != "" && !v.validMobile(u.Mobile) {
+		ve.add("mobile", RuleFormat, "mobile is not a valid number")
+	}
+	if u.Gender != "" && !validGender(u.Gender) {
+		ve.add("gender", RuleFormat, "gender must be one of M, F or U")
+	}
+	if !validDate(u.Birthday) {
+		ve.add("birthday", RuleDate, "birthday must be a date as "+dateFormats)
+	}
+	if !validDate(u.JoinDate) {
+		ve.add("joinDate", RuleDate, "joinDate must be a date as "+dateFormats)
+	}
+	if u.IDCN != "" {
+		if rule := checkIDCN(u.IDCN); rule != "" {
+			ve.add("idcn", rule, "idcn is not a valid resident ID number")
+		}
+	}
+
+	if len(ve.Errors) > 0 {
+		return ve
+	}
+	return nil
+}
+
+// ValidateFields like Validate, only errors of fields by JSON name, such as the fields changed by an update,
+// so that an old value failing the rules does not block changes of other fields
+func (v *Validator) ValidateFields(u *People, fields ...string) error {
+	err := v.Validate(u)
+	ve, ok := err.(*ValidationError)
+	if !ok {
+		return err
+	}
+	want := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		want[f] = true
+	}
+	out := new(ValidationError)
+	for _, fe := range ve.Errors {
+		if want[fe.Field] {
+			out.Errors = append(out.Errors, fe)
+		}
+	}
+	if len(out.Errors) > 0 {
+		return out
+	}
+	return nil
+}
+
+// Validate checks the people with the default Validator
+func (u *People) Validate() error {
+	return new(Validator).Validate(u)
+}
+
+// Initial returns the first character of s, empty if s is empty
+func Initial(s string) string {
+	_, size := utf8.DecodeRuneInString(s)
+	return s[:size]
+}
+
+func validEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return false
+	}
+	at := strings.LastIndexByte(s, '@')
+	return at > 0 && strings.Contains(s[at+1:], ".")
+}
+
+// dateFormats accepted by ParseDate, stored as YYYYMMDD
+const dateFormats = "YYYYMMDD, YYYY-MM-DD, YYYY/M/D, YYYY.MM.DD or RFC 3339"
+
+// validDate reports whether d is empty, or normalized to a day as YYYYMMDD
+func validDate(d Date) bool {
+	if d.IsZero() {
+		return true
+	}
+	s := d.LDAP()
+	if !reDate.MatchString(s) {
+		return false
+	}
+	_, err := time.Parse(DateLayoutLDAP, s)
+	return err == nil
+}
+
+func validGender(s string) bool {
+	switch strings.ToUpper(s) {
+	case "M", "F", "U":
+		return true
+	}
+	return false
+}
+
+func (v *Validator) validMobile(s string) bool {
+	s = mobileStripper.Replace(s)
+	rules := v.MobileRules
+	if rules == nil {
+		rules = DefaultMobileRules
+	}
+	if !strings.HasPrefix(s, "+") {
+		region := v.Region
+		if region == "" {
+			region = DefaultRegion
+		}
+		s = "+" + region + s
+	}
+	if !reE164.MatchString(s) {
+		return false
+	}
+	// calling codes are prefix free, 1 to 3 digits
+	for n := 1; n <= 3; n++ {
+		if re, ok := rules[s[1:1+n]]; ok {
+			return re.MatchString(s[1+n:])
+		}
+	}
+	return true
+}
+
+var (
+	idcnWeights = []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	idcnChecks  = "10X98765432"
+)
+
+// checkIDCN returns the failed rule of a resident ID number of 18 characters,
+// or of 15 digits of the first generation without checksum, empty if valid
+func checkIDCN(s string) string {
+	if len(s) == 15 {
+		if !reDigit.MatchString(s) {
+			return RuleFormat
+		}
+		if _, err := time.Parse(DateLayoutLDAP, "19"+s[6:12]); err != nil {
+			return RuleDate
+		}
+		return ""
+	}
+	if len(s) != 18 || !reDigit.MatchString(s[:17]) {
+		return RuleFormat
+	}
+	if born, err := time.Parse(DateLayoutLDAP, s[6:14]); err != nil || born.After(time.Now()) {
+		return RuleDate
+	}
+	sum := 0
+	for i, w := range idcnWeights {
+		sum += int(s[i]-'0') * w
+	}
+	if idcnChecks[sum%11] != strings.ToUpper(s[17:])[0] {
+		return RuleChecksum
+	}
+	return ""
+}
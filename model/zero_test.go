@@ -1,8 +1,18 @@
 package model
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"log/slog"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,8 +52,9 @@ func TestPeople(t *testing.T) {
 	p.AvatarPath = ""
 	jh := []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10}
 	p.JpegPhoto = jh
-	dataURI := URIPrefixData + base64.URLEncoding.EncodeToString(jh)
+	dataURI := URIPrefixData + base64.StdEncoding.EncodeToString(jh)
 	assert.Equal(t, dataURI, p.AvatarURI())
+	assert.Equal(t, "data:image/jpeg;base64,/9j/4AAQ", p.AvatarURI())
 }
 
 func TestPeoples(t *testing.T) {
@@ -67,3 +78,292 @@ func TestGroup(t *testing.T) {
 
 	assert.True(t, g.Has("uid"))
 }
+
+func TestPeopleLogValue(t *testing.T) {
+	p := &People{UID: "doe", CommonName: "Doe", Mobile: "13800138000", Email: "doe@example.org",
+		Birthday: "19900101", IDCN: "110101199001011234", JpegPhoto: []byte("abc")}
+
+	var sb strings.Builder
+	lg := slog.New(slog.NewTextHandler(&sb, nil))
+	lg.Info("save", "staff", p)
+	out := sb.String()
+	assert.Contains(t, out, "staff.uid=doe")
+	assert.Contains(t, out, "staff.mobile=****8000")
+	assert.Contains(t, out, "staff.email=****.org")
+	assert.Contains(t, out, "staff.idcn="+Redacted)
+	assert.Contains(t, out, "staff.birthday="+Redacted)
+	assert.Contains(t, out, `staff.jpegPhoto="3 bytes"`)
+	assert.NotContains(t, out, "13800138000")
+	assert.NotContains(t, out, "110101199001011234")
+
+	SetLogPolicy(&LogPolicy{Fields: DefaultLogPolicy.Fields, Unredacted: true})
+	defer SetLogPolicy(nil)
+	sb.Reset()
+	lg.Info("save", "staff", *p)
+	assert.Contains(t, sb.String(), "staff.idcn=110101199001011234")
+	assert.Equal(t, "****", DefaultLogPolicy.Redact("mobile", "1234"))
+	assert.Equal(t, "", DefaultLogPolicy.Redact("idcn", ""))
+}
+
+func TestPeoplePatch(t *testing.T) {
+	p, err := DecodeMergePatch([]byte(`{"nickname":"Doe","description":null,"mobile":""}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"description", "mobile", "nickname"}, p.Fields())
+	v, ok := p.Get("nickname")
+	assert.True(t, ok)
+	assert.Equal(t, "Doe", v)
+	v, ok = p.Get("description")
+	assert.True(t, ok)
+	assert.Empty(t, v)
+	_, ok = p.Get("email")
+	assert.False(t, ok)
+
+	u := &People{UID: "doe", Email: "doe@example.org", Description: "old", Mobile: "1380"}
+	p.Apply(u)
+	assert.Equal(t, "Doe", u.Nickname)
+	assert.Empty(t, u.Description)
+	assert.Empty(t, u.Mobile)
+	assert.Equal(t, "doe@example.org", u.Email)
+
+	_, err = DecodeMergePatch([]byte(`{"uid":"roe"}`))
+	assert.ErrorIs(t, err, ErrPatchUnknownField)
+	_, err = DecodeMergePatch([]byte(`{"nickname":1}`))
+	assert.ErrorIs(t, err, ErrPatchInvalidValue)
+	_, err = DecodeMergePatch([]byte(`[]`))
+	assert.ErrorIs(t, err, ErrPatchInvalidValue)
+
+	p = new(PeoplePatch)
+	assert.True(t, p.IsEmpty())
+	assert.NoError(t, p.Set("etype", "CEO"))
+	assert.NoError(t, p.Clear("gender"))
+	assert.Error(t, p.Set("uid", "x"))
+	assert.Equal(t, []string{"etype", "gender"}, p.Fields())
+}
+
+func TestPeopleValidate(t *testing.T) {
+	p := NewPeople("doe", "doe", "doe")
+	p.Email = "doe@example.org"
+	p.Mobile = "13012341234"
+	p.Gender = "f"
+	p.Birthday = "20000229"
+	p.JoinDate = "20200101"
+	p.IDCN = "11010519491231002X"
+	assert.NoError(t, p.Validate())
+
+	for _, mobile := range []string{"+86 130-1234-1234", "+85261234567", "+12025550123", "+4917012345678"} {
+		p.Mobile = mobile
+		assert.NoError(t, p.Validate(), mobile)
+	}
+
+	cases := []struct {
+		field, value, rule string
+	}{
+		{"uid", "Doe", RuleFormat},
+		{"sn", "", RuleRequired},
+		{"email", "doe", RuleFormat},
+		{"email", "Doe <doe@example.org>", RuleFormat},
+		{"mobile", "12012341234", RuleFormat},
+		{"mobile", "+85201234567", RuleFormat},
+		{"mobile", "+0123", RuleFormat},
+		{"gender", "x", RuleFormat},
+		{"birthday", "20010229", RuleDate},
+		{"joinDate", "2020-13-01", RuleDate},
+		{"joinDate", "2020-01", RuleDate},
+		{"birthday", "19900101000000Z", RuleDate},
+		{"idcn", "110105194912310021", RuleChecksum},
+		{"idcn", "110105194913310021", RuleDate},
+		{"idcn", "1101051949123100", RuleFormat},
+		{"idcn", "110105491331002", RuleDate},
+		{"idcn", "11010549123100X", RuleFormat},
+	}
+	for _, c := range cases {
+		u := *p
+		u.Mobile = "13012341234"
+		switch c.field {
+		case "uid":
+			u.UID = c.value
+		case "sn":
+			u.Surname = c.value
+		case "email":
+			u.Email = c.value
+		case "mobile":
+			u.Mobile = c.value
+		case "gender":
+			u.Gender = c.value
+		case "birthday":
+			u.Birthday = Date(c.value)
+		case "joinDate":
+			u.JoinDate = Date(c.value)
+		case "idcn":
+			u.IDCN = c.value
+		}
+		err := u.Validate()
+		assert.ErrorIs(t, err, ErrInvalidPeople, c.value)
+		var ve *ValidationError
+		if assert.ErrorAs(t, err, &ve) && assert.Len(t, ve.Errors, 1, c.value) {
+			assert.Equal(t, c.field, ve.Errors[0].Field)
+			assert.Equal(t, c.rule, ve.Errors[0].Rule, c.value)
+		}
+	}
+	u := *p
+	u.Mobile = "13012341234"
+	u.Birthday, u.JoinDate = "1990/5/1", "2020-07-01T09:00:00+08:00"
+	assert.NoError(t, u.Validate(), "normalized to YYYYMMDD")
+	u.IDCN = "110105491231002"
+	assert.NoError(t, u.Validate(), "15 digits of the first generation")
+
+	// only the fields given
+	u.Mobile, u.Email = "12345", "doe"
+	var ve *ValidationError
+	if assert.ErrorAs(t, new(Validator).ValidateFields(&u, "nickname", "email"), &ve) && assert.Len(t, ve.Errors, 1) {
+		assert.Equal(t, "email", ve.Errors[0].Field)
+	}
+	assert.NoError(t, new(Validator).ValidateFields(&u, "nickname"))
+
+	err := (&People{UID: "x y", Email: "bad"}).Validate()
+	assert.EqualError(t, err, "invalid people: sn, uid, email")
+	assert.True(t, err.(*ValidationError).Has("email"))
+	assert.ErrorIs(t, new(Validator).Validate(nil), ErrInvalidPeople)
+
+	v := &Validator{Required: []string{"uid", "email"}, Region: "852", UID: regexp.MustCompile(`^[A-Za-z]+$`)}
+	assert.NoError(t, v.Validate(&People{UID: "Doe", Email: "doe@example.org", Mobile: "61234567"}))
+
+	assert.Equal(t, "", Initial(""))
+	assert.Equal(t, "张", Initial("张三"))
+	assert.NotPanics(t, func() { NewPeople("") })
+	assert.Equal(t, "张", NewPeople("zhang", "张三").Surname)
+}
+
+func TestDate(t *testing.T) {
+	for _, s := range []string{"19870526", "1987-05-26", "1987/5/26", "1987.05.26", " 1987-05-26 ", "1987-05-26T08:00:00+08:00"} {
+		d, err := ParseDate(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, Date("19870526"), d, s)
+		assert.Equal(t, "1987-05-26", Date(s).ISO(), s)
+		assert.Equal(t, "19870526", Date(s).LDAP(), s)
+		assert.Equal(t, time.May, Date(s).Month(), s)
+	}
+	_, err := ParseDate("19870230")
+	assert.ErrorIs(t, err, ErrInvalidDate)
+	bad := Date("someday")
+	assert.False(t, bad.Valid())
+	assert.Equal(t, "someday", bad.LDAP())
+	assert.Equal(t, time.Month(0), bad.Month())
+	assert.True(t, Date("").Valid())
+	assert.Equal(t, Date("20200102"), NewDate(time.Date(2020, 1, 2, 23, 0, 0, 0, time.Local)))
+
+	p := &People{UID: "doe", Birthday: "19870526"}
+	b, err := json.Marshal(p)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"birthday":"1987-05-26"`)
+	assert.NotContains(t, string(b), "joinDate")
+	var u People
+	assert.NoError(t, json.Unmarshal([]byte(`{"birthday":"1987/5/26","joinDate":"legacy"}`), &u))
+	assert.Equal(t, Date("19870526"), u.Birthday)
+	assert.Equal(t, Date("legacy"), u.JoinDate)
+	assert.Error(t, json.Unmarshal([]byte(`{"birthday":1987}`), &u))
+
+	r := &DateRange{From: "1980-01-01", To: "19891231"}
+	assert.True(t, r.Contains("19870526"))
+	assert.True(t, r.Contains("1989-12-31"))
+	assert.False(t, r.Contains("19900101"))
+	assert.False(t, r.Contains(""))
+	assert.True(t, (&DateRange{From: "1980-01-01"}).Contains("20200101"))
+
+	spec := &Spec{Birthday: r, BirthMonth: time.May}
+	assert.True(t, spec.MatchDates(p))
+	spec.BirthMonth = time.June
+	assert.False(t, spec.MatchDates(p))
+	spec = &Spec{JoinDate: &DateRange{To: "20000101"}}
+	assert.False(t, spec.MatchDates(p), "no joinDate")
+	assert.True(t, new(Spec).MatchDates(p))
+}
+
+func TestAvatarResolvers(t *testing.T) {
+	defer SetAvatarResolvers()
+	p := &People{UID: "doe", GivenName: "john", Surname: "doe", Email: " Doe@Example.org"}
+
+	p.AvatarPath = "/bizmail/abc/0"
+	assert.Equal(t, URIPrefixQqcn+"/bizmail/abc/60", p.AvatarURI())
+	assert.Equal(t, URIPrefixQqcn+"/bizmail/abc/100", p.AvatarURIOf(80))
+	assert.Equal(t, URIPrefixQqcn+"/bizmail/abc/0", p.AvatarURIOf(1000))
+	p.AvatarPath = "/wwpic/abc/"
+	assert.Equal(t, URIPrefixWxcn+"/wwpic/abc/40", p.AvatarURIOf(32))
+	p.AvatarPath = "https://example.org/a/"
+	assert.Equal(t, "https://example.org/a/0", p.AvatarURIOf(32))
+
+	SetAvatarResolvers(append(DefaultAvatarResolvers()[:3], &PathResolver{Base: "https://cdn.example.org/", SizeParam: "w"})...)
+	p.AvatarPath = "/avatars/doe.png"
+	assert.Equal(t, "https://cdn.example.org/avatars/doe.png", p.AvatarURI())
+	assert.Equal(t, "https://cdn.example.org/avatars/doe.png?w=96", p.AvatarURIOf(96))
+	p.AvatarPath = ""
+	assert.Empty(t, p.AvatarURI())
+
+	RegisterAvatarResolver(&GravatarResolver{Default: "identicon"})
+	assert.Len(t, GetAvatarResolvers(), 5)
+	// sha256 of doe@example.org
+	sum := sha256.Sum256([]byte("doe@example.org"))
+	assert.Equal(t, DefaultGravatarBase+hex.EncodeToString(sum[:])+"?d=identicon&s=80", p.AvatarURIOf(80))
+
+	SetAvatarResolvers(&FallbackResolver{})
+	uri := p.AvatarURIOf(64)
+	if assert.True(t, strings.HasPrefix(uri, "data:image/svg+xml;base64,")) {
+		svg, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(uri, "data:image/svg+xml;base64,"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(svg), `width="64"`)
+		assert.Contains(t, string(svg), ">JD</text>")
+	}
+	assert.Equal(t, uri, p.AvatarURIOf(64), "stable")
+	SetAvatarResolvers(&FallbackResolver{Style: AvatarIdenticon})
+	svg, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(p.AvatarURI(), "data:image/svg+xml;base64,"))
+	assert.Contains(t, string(svg), `viewBox="0 0 5 5"`)
+
+	assert.Equal(t, "三", initials(&People{UID: "zhang", CommonName: "张三"}))
+	assert.Equal(t, "小明", initials(&People{UID: "wang", CommonName: "王小明"}))
+	assert.Equal(t, "D", initials(&People{UID: "doe"}))
+	assert.Equal(t, "&lt;", func() string {
+		var sb strings.Builder
+		xmlEscaper.WriteString(&sb, "<")
+		return sb.String()
+	}())
+
+	SetAvatarResolvers(AvatarResolverFunc(func(u *People, size int) (string, bool) {
+		return "/u/" + u.UID, true
+	}))
+	assert.Equal(t, "/u/doe", p.AvatarURI())
+}
+
+func TestPhotoResolverCache(t *testing.T) {
+	defer func(c *thumbCache) { thumbs = c }(thumbs)
+	thumbs = newThumbCache(2)
+
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 200, 100)), nil))
+	p := &People{UID: "doe", JpegPhoto: buf.Bytes()}
+	r := PhotoResolver{}
+
+	uri, ok := r.Resolve(p, 50)
+	assert.True(t, ok)
+	assert.True(t, strings.HasPrefix(uri, URIPrefixData))
+	key := thumbKey{sum: sha256.Sum256(p.JpegPhoto), size: 50}
+	cached, ok := thumbs.get(key)
+	assert.True(t, ok)
+	assert.Equal(t, uri, cached)
+	again, _ := r.Resolve(p, 50)
+	assert.Equal(t, uri, again)
+	assert.Equal(t, 1, thumbs.ll.Len())
+
+	full, _ := r.Resolve(p, 0)
+	assert.Equal(t, URIPrefixData+base64.StdEncoding.EncodeToString(p.JpegPhoto), full, "not cached")
+	assert.Equal(t, 1, thumbs.ll.Len())
+
+	// the least recently used is evicted
+	r.Resolve(p, 40)
+	thumbs.get(key)
+	r.Resolve(p, 30)
+	assert.Equal(t, 2, thumbs.ll.Len())
+	_, ok = thumbs.get(key)
+	assert.True(t, ok)
+	_, ok = thumbs.get(thumbKey{sum: key.sum, size: 40})
+	assert.False(t, ok)
+}
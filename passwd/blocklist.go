@@ -0,0 +1,66 @@
+package passwd
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Blocklist of passwords not allowed
+type Blocklist interface {
+	Contains(password string) bool
+}
+
+// WordList case-insensitive Blocklist
+type WordList map[string]struct{}
+
+var _ Blocklist = WordList(nil)
+
+// NewWordList ...
+func NewWordList(words ...string) WordList {
+	wl := make(WordList, len(words))
+	for _, w := range words {
+		wl.Add(w)
+	}
+	return wl
+}
+
+// LoadWordList reads one password per line, empty lines and lines starting with # are ignored
+func LoadWordList(r io.Reader) (WordList, error) {
+	wl := make(WordList)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		wl.Add(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return wl, nil
+}
+
+// Add ...
+func (wl WordList) Add(word string) {
+	wl[strings.ToLower(word)] = struct{}{}
+}
+
+// Contains ...
+func (wl WordList) Contains(password string) bool {
+	_, ok := wl[strings.ToLower(password)]
+	return ok
+}
+
+// CommonPasswords a small list of the most common passwords
+var CommonPasswords = NewWordList(
+	"123456", "123456789", "12345678", "12345", "1234567", "1234567890", "123123",
+	"111111", "000000", "666666", "888888", "987654321", "654321", "112233", "121212",
+	"password", "password1", "password123", "passw0rd", "p@ssw0rd", "p@ssword",
+	"qwerty", "qwerty123", "qwertyuiop", "1q2w3e4r", "1qaz2wsx", "qazwsx", "asdfgh",
+	"abc123", "abcd1234", "a123456", "aa123456", "admin", "admin123", "root", "toor",
+	"letmein", "welcome", "welcome1", "iloveyou", "monkey", "dragon", "sunshine",
+	"princess", "football", "baseball", "master", "superman", "secret", "changeme",
+	"woaini", "woaini1314", "5201314", "1314520", "zxcvbnm", "zxcvbn",
+)
@@ -0,0 +1,168 @@
+package passwd
+
+import (
+	"crypto/rand"
+	"crypto/sha1" // nolint
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// schemes of userPassword
+const (
+	SchemeSSHA         = "{SSHA}"
+	SchemeSSHA512      = "{SSHA512}"
+	SchemePBKDF2       = "{PBKDF2}" // PBKDF2 with SHA-1
+	SchemePBKDF2SHA256 = "{PBKDF2-SHA256}"
+	SchemePBKDF2SHA512 = "{PBKDF2-SHA512}"
+	SchemeCrypt        = "{CRYPT}" // bcrypt only
+)
+
+// defaults
+const (
+	DefaultScheme       = SchemeSSHA
+	DefaultPBKDF2Rounds = 10000
+	DefaultBcryptCost   = bcrypt.DefaultCost
+
+	saltSize = 16
+)
+
+// vars
+var (
+	ErrUnsupportedScheme = errors.New("unsupported password scheme")
+	ErrInvalidHash       = errors.New("invalid hashed password")
+)
+
+// ab64 adapted base64 of OpenLDAP pw-pbkdf2
+var ab64 = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789./").WithPadding(base64.NoPadding)
+
+// Hash password with scheme in the format of userPassword, such as {SSHA}base64
+func Hash(scheme, password string) (string, error) {
+	scheme = strings.ToUpper(scheme)
+	switch scheme {
+	case SchemeSSHA:
+		return hashSalted(scheme, sha1.New, password)
+	case SchemeSSHA512:
+		return hashSalted(scheme, sha512.New, password)
+	case SchemePBKDF2, SchemePBKDF2SHA256, SchemePBKDF2SHA512:
+		salt, err := newSalt()
+		if err != nil {
+			return "", err
+		}
+		h, size := pbkdf2Hash(scheme)
+		dk := pbkdf2.Key([]byte(password), salt, DefaultPBKDF2Rounds, size, h)
+		return scheme + strconv.Itoa(DefaultPBKDF2Rounds) + "$" + ab64.EncodeToString(salt) + "$" + ab64.EncodeToString(dk), nil
+	case SchemeCrypt:
+		b, err := bcrypt.GenerateFromPassword([]byte(password), DefaultBcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return scheme + string(b), nil
+	}
+	return "", ErrUnsupportedScheme
+}
+
+// Verify password with a hashed value of userPassword, value without scheme is cleartext
+func Verify(hashed, password string) (bool, error) {
+	scheme, value := splitScheme(hashed)
+	switch scheme {
+	case "":
+		return subtle.ConstantTimeCompare([]byte(value), []byte(password)) == 1, nil
+	case SchemeSSHA:
+		return verifySalted(sha1.New, value, password)
+	case SchemeSSHA512:
+		return verifySalted(sha512.New, value, password)
+	case SchemePBKDF2, SchemePBKDF2SHA256, SchemePBKDF2SHA512:
+		parts := strings.Split(value, "$")
+		if len(parts) != 3 {
+			return false, ErrInvalidHash
+		}
+		rounds, err := strconv.Atoi(parts[0])
+		if err != nil || rounds <= 0 {
+			return false, ErrInvalidHash
+		}
+		salt, err := ab64.DecodeString(parts[1])
+		if err != nil {
+			return false, ErrInvalidHash
+		}
+		want, err := ab64.DecodeString(parts[2])
+		if err != nil || len(want) == 0 {
+			return false, ErrInvalidHash
+		}
+		h, _ := pbkdf2Hash(scheme)
+		dk := pbkdf2.Key([]byte(password), salt, rounds, len(want), h)
+		return subtle.ConstantTimeCompare(dk, want) == 1, nil
+	case SchemeCrypt:
+		if !strings.HasPrefix(value, "$2") {
+			return false, ErrUnsupportedScheme
+		}
+		err := bcrypt.CompareHashAndPassword([]byte(value), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		if err != nil {
+			return false, ErrInvalidHash
+		}
+		return true, nil
+	}
+	return false, ErrUnsupportedScheme
+}
+
+func splitScheme(hashed string) (scheme, value string) {
+	if strings.HasPrefix(hashed, "{") {
+		if i := strings.Index(hashed, "}"); i > 0 {
+			return strings.ToUpper(hashed[:i+1]), hashed[i+1:]
+		}
+	}
+	return "", hashed
+}
+
+func pbkdf2Hash(scheme string) (func() hash.Hash, int) {
+	switch scheme {
+	case SchemePBKDF2SHA256:
+		return sha256.New, sha256.Size
+	case SchemePBKDF2SHA512:
+		return sha512.New, sha512.Size
+	}
+	return sha1.New, sha1.Size
+}
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+func hashSalted(scheme string, h func() hash.Hash, password string) (string, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return "", err
+	}
+	return scheme + base64.StdEncoding.EncodeToString(sumSalted(h, password, salt)), nil
+}
+
+func verifySalted(h func() hash.Hash, value, password string) (bool, error) {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	size := h().Size()
+	if err != nil || len(raw) <= size {
+		return false, ErrInvalidHash
+	}
+	return subtle.ConstantTimeCompare(raw, sumSalted(h, password, raw[size:])) == 1, nil
+}
+
+func sumSalted(h func() hash.Hash, password string, salt []byte) []byte {
+	d := h()
+	d.Write([]byte(password))
+	d.Write(salt)
+	return append(d.Sum(nil), salt...)
+}
@@ -0,0 +1,57 @@
+package passwd
+
+import (
+	"sync"
+)
+
+// History keeps hashed passwords of users
+type History interface {
+	// Recent returns the last n hashed passwords of uid, newest first
+	Recent(uid string, n int) ([]string, error)
+	// Push adds a hashed password of uid, keeps the last keep ones
+	Push(uid, hashed string, keep int) error
+}
+
+// MemoryHistory in-memory History
+type MemoryHistory struct {
+	mu   sync.Mutex
+	data map[string][]string
+}
+
+var _ History = (*MemoryHistory)(nil)
+
+// NewMemoryHistory ...
+func NewMemoryHistory() *MemoryHistory {
+	return &MemoryHistory{data: make(map[string][]string)}
+}
+
+// Recent ...
+func (h *MemoryHistory) Recent(uid string, n int) ([]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	arr := h.data[uid]
+	if n < len(arr) {
+		arr = arr[:n]
+	}
+	return append([]string(nil), arr...), nil
+}
+
+// Push ...
+func (h *MemoryHistory) Push(uid, hashed string, keep int) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	arr := append([]string{hashed}, h.data[uid]...)
+	if keep > 0 && len(arr) > keep {
+		arr = arr[:keep]
+	}
+	h.data[uid] = arr
+	return nil
+}
+
+func hashHistory(password string) (string, error) {
+	return Hash(SchemeSSHA512, password)
+}
+
+func verifyHistory(hashed, password string) (bool, error) {
+	return Verify(hashed, password)
+}
@@ -0,0 +1,267 @@
+// Package passwd checks passwords against a configurable policy and hashes them for userPassword
+package passwd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/liut/staffio-backend/model"
+)
+
+// vars
+var (
+	ErrPolicyViolation = errors.New("password violates policy")
+)
+
+// rules
+const (
+	RuleMinLength = "minLength"
+	RuleMaxLength = "maxLength"
+	RuleLower     = "lower"
+	RuleUpper     = "upper"
+	RuleDigit     = "digit"
+	RuleSymbol    = "symbol"
+	RuleClasses   = "classes"
+	RuleSimilar   = "similar"
+	RuleBlocked   = "blocked"
+	RuleHistory   = "history"
+)
+
+// DefaultMaxSimilarity ratio of similarity to reject
+const DefaultMaxSimilarity = 0.7
+
+// Violation a failed rule
+type Violation struct {
+	Rule    string `json:"rule"`
+	Field   string `json:"field,omitempty"` // uid, cn or email for rule similar
+	Limit   int    `json:"limit,omitempty"`
+	Message string `json:"message"`
+}
+
+// ViolationError lists every failed rule, matches ErrPolicyViolation with errors.Is
+type ViolationError struct {
+	Violations []Violation `json:"violations"`
+}
+
+func (e *ViolationError) Error() string {
+	rules := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		rules[i] = v.Rule
+	}
+	return ErrPolicyViolation.Error() + ": " + strings.Join(rules, ", ")
+}
+
+// Is ...
+func (e *ViolationError) Is(target error) bool {
+	return target == ErrPolicyViolation
+}
+
+// Has reports whether rule failed
+func (e *ViolationError) Has(rule string) bool {
+	for _, v := range e.Violations {
+		if v.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *ViolationError) add(rule string, limit int, format string, args ...interface{}) {
+	e.Violations = append(e.Violations, Violation{Rule: rule, Limit: limit, Message: fmt.Sprintf(format, args...)})
+}
+
+// Policy of password, zero value checks nothing
+type Policy struct {
+	MinLength int `json:"minLength"`
+	MaxLength int `json:"maxLength"`
+
+	RequireLower  bool `json:"requireLower"`
+	RequireUpper  bool `json:"requireUpper"`
+	RequireDigit  bool `json:"requireDigit"`
+	RequireSymbol bool `json:"requireSymbol"`
+	MinClasses    int  `json:"minClasses"` // at least classes of lower, upper, digit and symbol
+
+	// CheckSimilarity rejects password like uid, cn or email
+	CheckSimilarity bool    `json:"checkSimilarity"`
+	MaxSimilarity   float64 `json:"maxSimilarity"` // default DefaultMaxSimilarity
+
+	Blocklist Blocklist `json:"-"`
+
+	// HistorySize rejects the last N passwords, History is required
+	HistorySize int     `json:"historySize"`
+	History     History `json:"-"`
+}
+
+// Check password for the people, return *ViolationError if any rule failed
+func (p *Policy) Check(staff *model.People, password string) error {
+	ve := new(ViolationError)
+	p.checkLength(ve, password)
+	p.checkClasses(ve, password)
+	if p.CheckSimilarity && staff != nil {
+		p.checkSimilarity(ve, staff, password)
+	}
+	if p.Blocklist != nil && p.Blocklist.Contains(password) {
+		ve.add(RuleBlocked, 0, "password is too common")
+	}
+	if p.HistorySize > 0 && p.History != nil && staff != nil {
+		hashes, err := p.History.Recent(staff.UID, p.HistorySize)
+		if err != nil {
+			return err
+		}
+		for _, hashed := range hashes {
+			if ok, _ := verifyHistory(hashed, password); ok {
+				ve.add(RuleHistory, p.HistorySize, "password is one of the last %d passwords", p.HistorySize)
+				break
+			}
+		}
+	}
+
+	if len(ve.Violations) > 0 {
+		return ve
+	}
+	return nil
+}
+
+// Remember keeps password in history after it changed
+func (p *Policy) Remember(uid, password string) error {
+	if p.HistorySize <= 0 || p.History == nil {
+		return nil
+	}
+	hashed, err := hashHistory(password)
+	if err != nil {
+		return err
+	}
+	return p.History.Push(uid, hashed, p.HistorySize)
+}
+
+func (p *Policy) checkLength(ve *ViolationError, password string) {
+	n := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && n < p.MinLength {
+		ve.add(RuleMinLength, p.MinLength, "password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		ve.add(RuleMaxLength, p.MaxLength, "password must be at most %d characters", p.MaxLength)
+	}
+}
+
+func (p *Policy) checkClasses(ve *ViolationError, password string) {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireLower && !lower {
+		ve.add(RuleLower, 0, "password must contain a lowercase letter")
+	}
+	if p.RequireUpper && !upper {
+		ve.add(RuleUpper, 0, "password must contain an uppercase letter")
+	}
+	if p.RequireDigit && !digit {
+		ve.add(RuleDigit, 0, "password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		ve.add(RuleSymbol, 0, "password must contain a symbol")
+	}
+	if p.MinClasses > 0 {
+		var n int
+		for _, ok := range []bool{lower, upper, digit, symbol} {
+			if ok {
+				n++
+			}
+		}
+		if n < p.MinClasses {
+			ve.add(RuleClasses, p.MinClasses, "password must contain at least %d of lowercase, uppercase, digit and symbol", p.MinClasses)
+		}
+	}
+}
+
+func (p *Policy) checkSimilarity(ve *ViolationError, staff *model.People, password string) {
+	max := p.MaxSimilarity
+	if max <= 0 {
+		max = DefaultMaxSimilarity
+	}
+	fields := []struct {
+		name   string
+		values []string
+	}{
+		{"uid", []string{staff.UID}},
+		{"cn", append([]string{staff.CommonName}, strings.Fields(staff.CommonName)...)},
+		{"email", []string{staff.Email, localPart(staff.Email)}},
+	}
+	for _, f := range fields {
+		for _, v := range f.values {
+			if similar(password, v, max) {
+				ve.Violations = append(ve.Violations, Violation{
+					Rule:    RuleSimilar,
+					Field:   f.name,
+					Message: "password is too similar to " + f.name,
+				})
+				break
+			}
+		}
+	}
+}
+
+func localPart(email string) string {
+	if i := strings.LastIndex(email, "@"); i > 0 {
+		return email[:i]
+	}
+	return ""
+}
+
+// similar reports whether a and b contain each other or have a similarity ratio not less than max
+func similar(a, b string, max float64) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if utf8.RuneCountInString(b) < 3 || a == "" {
+		return false
+	}
+	if strings.Contains(a, b) || strings.Contains(b, a) {
+		return true
+	}
+	ra, rb := []rune(a), []rune(b)
+	n := len(ra)
+	if len(rb) > n {
+		n = len(rb)
+	}
+	return 1-float64(levenshtein(ra, rb))/float64(n) >= max
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(a int, others ...int) int {
+	for _, b := range others {
+		if b < a {
+			a = b
+		}
+	}
+	return a
+}
@@ -0,0 +1,178 @@
+package passwd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/liut/staffio-backend/model"
+)
+
+func TestPolicyZero(t *testing.T) {
+	p := new(Policy)
+	assert.NoError(t, p.Check(nil, ""))
+	assert.NoError(t, p.Remember("doe", "secret"))
+}
+
+func TestPolicyCheck(t *testing.T) {
+	p := &Policy{
+		MinLength:       8,
+		MaxLength:       20,
+		RequireLower:    true,
+		RequireUpper:    true,
+		RequireDigit:    true,
+		RequireSymbol:   true,
+		MinClasses:      3,
+		CheckSimilarity: true,
+		Blocklist:       CommonPasswords,
+	}
+	staff := &model.People{UID: "fawn", CommonName: "Fawn Doe", Email: "tiny@deer.cc"}
+
+	err := p.Check(staff, "Good#Pass2020")
+	assert.NoError(t, err)
+
+	err = p.Check(staff, "abc")
+	assert.ErrorIs(t, err, ErrPolicyViolation)
+	var ve *ViolationError
+	if assert.True(t, errors.As(err, &ve)) {
+		for _, rule := range []string{RuleMinLength, RuleUpper, RuleDigit, RuleSymbol, RuleClasses} {
+			assert.True(t, ve.Has(rule), rule)
+		}
+		assert.False(t, ve.Has(RuleLower))
+		assert.False(t, ve.Has(RuleMaxLength))
+		assert.Equal(t, 8, ve.Violations[0].Limit)
+		assert.NotEmpty(t, ve.Violations[0].Message)
+		assert.True(t, strings.HasPrefix(ve.Error(), ErrPolicyViolation.Error()))
+	}
+
+	err = p.Check(staff, strings.Repeat("Ab1#", 6))
+	if assert.True(t, errors.As(err, &ve)) {
+		assert.Equal(t, []Violation{{Rule: RuleMaxLength, Limit: 20, Message: "password must be at most 20 characters"}}, ve.Violations)
+	}
+
+	err = p.Check(staff, "P@ssw0rd")
+	if assert.True(t, errors.As(err, &ve)) {
+		assert.Len(t, ve.Violations, 1)
+		assert.True(t, ve.Has(RuleBlocked))
+	}
+}
+
+func TestPolicySimilarity(t *testing.T) {
+	p := &Policy{CheckSimilarity: true}
+	staff := &model.People{UID: "fawn", CommonName: "Fawn Doe", Email: "tiny.deer@deer.cc"}
+
+	cases := []struct {
+		password string
+		field    string
+	}{
+		{"Fawn2020!", "uid"},
+		{"xx-doe-xx", "cn"},
+		{"tiny.deer", "email"},
+		{"tiny.dear", "email"},
+		{"Good#Pass2020", ""},
+	}
+	for _, c := range cases {
+		err := p.Check(staff, c.password)
+		if c.field == "" {
+			assert.NoError(t, err, c.password)
+			continue
+		}
+		var ve *ViolationError
+		if assert.True(t, errors.As(err, &ve), c.password) {
+			assert.Equal(t, RuleSimilar, ve.Violations[0].Rule)
+			assert.Equal(t, c.field, ve.Violations[0].Field, c.password)
+		}
+	}
+
+	assert.Equal(t, 3, levenshtein([]rune("kitten"), []rune("sitting")))
+}
+
+func TestPolicyHistory(t *testing.T) {
+	p := &Policy{HistorySize: 2, History: NewMemoryHistory()}
+	staff := &model.People{UID: "doe"}
+
+	for _, pwd := range []string{"first", "second", "third"} {
+		assert.NoError(t, p.Check(staff, pwd))
+		assert.NoError(t, p.Remember(staff.UID, pwd))
+	}
+
+	err := p.Check(staff, "third")
+	var ve *ViolationError
+	if assert.True(t, errors.As(err, &ve)) {
+		assert.True(t, ve.Has(RuleHistory))
+		assert.Equal(t, 2, ve.Violations[0].Limit)
+	}
+	assert.Error(t, p.Check(staff, "second"))
+	assert.NoError(t, p.Check(staff, "first"))
+	assert.NoError(t, p.Check(&model.People{UID: "cat"}, "third"))
+
+	ok, err := verifyHistory("{SSHA}abc", "third")
+	assert.False(t, ok)
+	assert.Error(t, err)
+}
+
+func TestWordList(t *testing.T) {
+	wl, err := LoadWordList(strings.NewReader("# comment\n\nHello\n  world  \n"))
+	assert.NoError(t, err)
+	assert.Len(t, wl, 2)
+	assert.True(t, wl.Contains("hello"))
+	assert.True(t, wl.Contains("WORLD"))
+	assert.False(t, wl.Contains("# comment"))
+	assert.True(t, CommonPasswords.Contains("Password"))
+}
+
+func TestHashVerify(t *testing.T) {
+	for _, scheme := range []string{SchemeSSHA, SchemeSSHA512, SchemePBKDF2, SchemePBKDF2SHA256, SchemePBKDF2SHA512, SchemeCrypt} {
+		hashed, err := Hash(scheme, "secret")
+		if !assert.NoError(t, err, scheme) {
+			continue
+		}
+		assert.True(t, strings.HasPrefix(hashed, scheme), hashed)
+		ok, err := Verify(hashed, "secret")
+		assert.NoError(t, err, scheme)
+		assert.True(t, ok, scheme)
+		ok, err = Verify(hashed, "bad")
+		assert.NoError(t, err, scheme)
+		assert.False(t, ok, scheme)
+
+		other, _ := Hash(scheme, "secret")
+		assert.NotEqual(t, hashed, other, "salted "+scheme)
+	}
+
+	_, err := Hash("{MD5}", "secret")
+	assert.Equal(t, ErrUnsupportedScheme, err)
+}
+
+func TestVerifyKnown(t *testing.T) {
+	known := []string{
+		"{SSHA}tCNGqyJLk/uvKpCa4vga5GB2gWoxMjM0NTY3OA==",
+		"{ssha}tCNGqyJLk/uvKpCa4vga5GB2gWoxMjM0NTY3OA==",
+		"{SSHA512}iWwx8naQWtJKIoYOgnIUnOjDVRc/KB/avnmg7rvibFhiLlylVmd8s/TomzyGqQwBOpJzU5z2YBupYIJWW8egvDEyMzQ1Njc4",
+		"{PBKDF2-SHA256}1000$MTIzNDU2Nzg$UrpqPmdAtUUKf4/BH0mYF3bivSQLlyWRZwzQD.P30eQ",
+		"secret",
+	}
+	for _, hashed := range known {
+		ok, err := Verify(hashed, "secret")
+		assert.NoError(t, err, hashed)
+		assert.True(t, ok, hashed)
+	}
+
+	bad := []string{
+		"{SSHA}short",
+		"{PBKDF2-SHA256}1000$MTIzNDU2Nzg",
+		"{PBKDF2-SHA256}x$MTIzNDU2Nzg$UrpqPmdAtUUKf4",
+		"{CRYPT}$2a$bad",
+	}
+	for _, hashed := range bad {
+		ok, err := Verify(hashed, "secret")
+		assert.Equal(t, ErrInvalidHash, err, hashed)
+		assert.False(t, ok)
+	}
+
+	_, err := Verify("{CRYPT}$6$salt$sha512crypt", "secret")
+	assert.Equal(t, ErrUnsupportedScheme, err)
+	_, err = Verify("{MD5}Xr4ilOzQ4PCOq3aQ0qbuaQ==", "secret")
+	assert.Equal(t, ErrUnsupportedScheme, err)
+}
@@ -0,0 +1,208 @@
+// Package photo validates, converts and resizes photos of People, such as jpegPhoto in LDAP
+package photo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+)
+
+// types of photo
+const (
+	MIMEJPEG = "image/jpeg"
+	MIMEPNG  = "image/png"
+)
+
+// defaults
+const (
+	DefaultMaxSize   = 256 << 10 // bytes
+	DefaultMaxPixels = 4096 * 4096
+	DefaultQuality   = 85
+	DefaultThumbSize = 96
+)
+
+// nolint
+var (
+	ErrEmpty    = errors.New("photo: empty")
+	ErrFormat   = errors.New("photo: not a JPEG or PNG")
+	ErrTooLarge = errors.New("photo: too large")
+)
+
+var (
+	magicJPEG = []byte{0xff, 0xd8, 0xff}
+	magicPNG  = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// Detect returns the type of data by magic bytes, empty if neither JPEG nor PNG
+func Detect(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, magicJPEG):
+		return MIMEJPEG
+	case bytes.HasPrefix(data, magicPNG):
+		return MIMEPNG
+	}
+	return ""
+}
+
+// Check returns the type of data, an error if empty, not JPEG or PNG, larger than maxSize bytes
+// or a broken header, maxSize <= 0 for DefaultMaxSize
+func Check(data []byte, maxSize int) (string, error) {
+	if len(data) == 0 {
+		return "", ErrEmpty
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if len(data) > maxSize {
+		return "", fmt.Errorf("%w: %d bytes, max %d", ErrTooLarge, len(data), maxSize)
+	}
+	mime := Detect(data)
+	if mime == "" {
+		return "", ErrFormat
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrFormat, err)
+	}
+	if cfg.Width*cfg.Height > DefaultMaxPixels {
+		return "", fmt.Errorf("%w: %dx%d pixels", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+	return mime, nil
+}
+
+// ToJPEG checks and decodes data fully, returns it re-encoded as JPEG, a PNG on white,
+// so that EXIF and other metadata are dropped and a broken body is an ErrFormat.
+// A JPEG larger than maxSize is encoded again in lower quality, then downscaled, else ErrTooLarge
+func ToJPEG(data []byte, maxSize int) ([]byte, error) {
+	mime, err := Check(data, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	var img image.Image
+	if mime == MIMEJPEG {
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	} else {
+		img, err = png.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFormat, err)
+	}
+	if mime == MIMEPNG {
+		img = flatten(img, img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	return fit(img, maxSize)
+}
+
+// qualities tried in turn to fit a JPEG in the max size
+var qualities = []int{DefaultQuality, 70, 55, 40}
+
+// minFitSize the smallest side of a photo downscaled to fit
+const minFitSize = 32
+
+// fit encodes img within maxSize bytes, in lower quality then halved until a side is below minFitSize
+func fit(img image.Image, maxSize int) ([]byte, error) {
+	var out []byte
+	for {
+		for _, q := range qualities {
+			var err error
+			if out, err = encodeQuality(img, q); err != nil {
+				return nil, err
+			}
+			if len(out) <= maxSize {
+				return out, nil
+			}
+		}
+		w, h := img.Bounds().Dx()/2, img.Bounds().Dy()/2
+		if w < minFitSize || h < minFitSize {
+			return nil, fmt.Errorf("%w: %d bytes as JPEG, max %d", ErrTooLarge, len(out), maxSize)
+		}
+		img = flatten(img, w, h)
+	}
+}
+
+// Thumbnail returns a JPEG fitting in size x size, not enlarged, size <= 0 for DefaultThumbSize
+func Thumbnail(data []byte, size int) ([]byte, error) {
+	if _, err := Check(data, len(data)); err != nil {
+		return nil, err
+	}
+	if size <= 0 {
+		size = DefaultThumbSize
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFormat, err)
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+	return encode(flatten(img, w, h))
+}
+
+// DataURI returns a data URI of data in standard base64, empty if neither JPEG nor PNG
+func DataURI(data []byte) string {
+	mime := Detect(data)
+	if mime == "" {
+		return ""
+	}
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+func encode(img image.Image) ([]byte, error) {
+	return encodeQuality(img, DefaultQuality)
+}
+
+func encodeQuality(img image.Image, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// flatten scales src to w x h by averaging areas, composed on white
+func flatten(src image.Image, w, h int) *image.RGBA {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := sb.Min.Y+y*sh/h, sb.Min.Y+(y+1)*sh/h
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := sb.Min.X+x*sw/w, sb.Min.X+(x+1)*sw/w
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			// premultiplied, so white shows through by 1 - alpha
+			white := 0xffff - a/n
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r/n + white),
+				G: uint16(g/n + white),
+				B: uint16(b/n + white),
+				A: 0xffff,
+			})
+		}
+	}
+	return dst
+}
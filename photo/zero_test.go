@@ -0,0 +1,166 @@
+package photo
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newImage(w, h int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCheck(t *testing.T) {
+	jpg := encodeJPEG(t, newImage(40, 20, color.Black))
+	pic := encodePNG(t, newImage(40, 20, color.White))
+	assert.Equal(t, MIMEJPEG, Detect(jpg))
+	assert.Equal(t, MIMEPNG, Detect(pic))
+	assert.Empty(t, Detect([]byte("GIF89a")))
+
+	mime, err := Check(jpg, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, MIMEJPEG, mime)
+	mime, err = Check(pic, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, MIMEPNG, mime)
+
+	_, err = Check(nil, 0)
+	assert.ErrorIs(t, err, ErrEmpty)
+	_, err = Check([]byte("GIF89a"), 0)
+	assert.ErrorIs(t, err, ErrFormat)
+	_, err = Check(jpg[:4], 0)
+	assert.ErrorIs(t, err, ErrFormat, "broken header")
+	_, err = Check(jpg, len(jpg)-1)
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestToJPEG(t *testing.T) {
+	jpg := encodeJPEG(t, newImage(40, 20, color.Black))
+	exif := append([]byte{0xff, 0xe1, 0x00, 0x14}, "Exif\x00\x00GPS-SERIAL-1"...)
+	tagged := append(append(append([]byte(nil), jpg[:2]...), exif...), jpg[2:]...)
+	_, err := Check(tagged, 0)
+	assert.NoError(t, err)
+	out, err := ToJPEG(tagged, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, MIMEJPEG, Detect(out))
+		assert.False(t, bytes.Contains(out, []byte("GPS-SERIAL")), "metadata dropped")
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(out))
+		assert.NoError(t, err)
+		assert.Equal(t, 40, cfg.Width)
+	}
+
+	// a valid header with a broken body
+	sos := bytes.Index(jpg, []byte{0xff, 0xda})
+	sos += 2 + int(jpg[sos+2])<<8 + int(jpg[sos+3])
+	broken := append(append([]byte(nil), jpg[:sos]...), "garbage"...)
+	_, err = Check(broken, 0)
+	assert.NoError(t, err)
+	_, err = ToJPEG(broken, 0)
+	assert.ErrorIs(t, err, ErrFormat)
+
+	// transparent on white
+	pic := encodePNG(t, newImage(40, 20, color.NRGBA{}))
+	out, err = ToJPEG(pic, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, MIMEJPEG, Detect(out))
+		img, err := jpeg.Decode(bytes.NewReader(out))
+		if assert.NoError(t, err) {
+			assert.Equal(t, image.Rect(0, 0, 40, 20), img.Bounds())
+			r, g, b, _ := img.At(10, 10).RGBA()
+			assert.True(t, r > 0xf000 && g > 0xf000 && b > 0xf000, "white")
+		}
+	}
+}
+
+func TestToJPEGMaxSize(t *testing.T) {
+	// a flat PNG is small, larger as JPEG
+	gray := image.NewGray(image.Rect(0, 0, 1200, 1200))
+	for i := range gray.Pix {
+		gray.Pix[i] = 0x80
+	}
+	pic := encodePNG(t, gray)
+	big, err := encode(gray)
+	assert.NoError(t, err)
+	maxSize := len(big) / 2
+	if !assert.Less(t, len(pic), maxSize) {
+		return
+	}
+	out, err := ToJPEG(pic, maxSize)
+	if assert.NoError(t, err) {
+		assert.LessOrEqual(t, len(out), maxSize)
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(out))
+		assert.NoError(t, err)
+		assert.Less(t, cfg.Width, 1200, "downscaled")
+	}
+
+	small := encodePNG(t, newImage(64, 64, color.White))
+	_, err = ToJPEG(small, len(small)+10)
+	assert.ErrorIs(t, err, ErrTooLarge, "no JPEG so small")
+}
+
+func TestThumbnail(t *testing.T) {
+	jpg := encodeJPEG(t, newImage(400, 200, color.RGBA{R: 0xff, A: 0xff}))
+	out, err := Thumbnail(jpg, 100)
+	if assert.NoError(t, err) {
+		img, err := jpeg.Decode(bytes.NewReader(out))
+		if assert.NoError(t, err) {
+			assert.Equal(t, image.Rect(0, 0, 100, 50), img.Bounds())
+			r, g, _, _ := img.At(50, 25).RGBA()
+			assert.True(t, r > 0xe000 && g < 0x2000, "red")
+		}
+	}
+
+	out, err = Thumbnail(encodePNG(t, newImage(30, 300, color.Black)), 0)
+	if assert.NoError(t, err) {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(out))
+		assert.NoError(t, err)
+		assert.Equal(t, 9, cfg.Width)
+		assert.Equal(t, DefaultThumbSize, cfg.Height)
+	}
+
+	out, err = Thumbnail(jpg, 1000)
+	if assert.NoError(t, err) {
+		cfg, _, _ := image.DecodeConfig(bytes.NewReader(out))
+		assert.Equal(t, 400, cfg.Width, "not enlarged")
+	}
+
+	_, err = Thumbnail([]byte("nope"), 10)
+	assert.ErrorIs(t, err, ErrFormat)
+}
+
+func TestDataURI(t *testing.T) {
+	jh := []byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x10}
+	assert.Equal(t, "data:image/jpeg;base64,/9j/4AAQ", DataURI(jh))
+	pic := encodePNG(t, newImage(1, 1, color.Black))
+	assert.True(t, strings.HasPrefix(DataURI(pic), "data:image/png;base64,iVBORw0KGgo"))
+	assert.Empty(t, DataURI([]byte("abc")))
+	assert.Empty(t, DataURI(nil))
+}
@@ -0,0 +1,60 @@
+package seal
+
+import (
+	"crypto/aes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// nolint
+var (
+	ErrUnknownKey = errors.New("seal: unknown key")
+	ErrNoKey      = errors.New("seal: no current key")
+)
+
+// KeyProvider provides key encryption keys by ID, a key is 16, 24 or 32 bytes of AES
+type KeyProvider interface {
+	// CurrentKey returns the key to seal new values
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key of id to open values, ErrUnknownKey if not found
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys a KeyProvider of keys in memory, to rotate add a new key and make it current,
+// old keys are kept to open existing values
+type StaticKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewStaticKeys ...
+func NewStaticKeys(current string, keys map[string][]byte) (*StaticKeys, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, ErrNoKey
+	}
+	sk := &StaticKeys{current: current, keys: make(map[string][]byte, len(keys))}
+	for id, key := range keys {
+		if id == "" || strings.ContainsAny(id, ".:") {
+			return nil, fmt.Errorf("seal: invalid key id %q", id)
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf("seal: key %q: %w", id, err)
+		}
+		sk.keys[id] = append([]byte(nil), key...)
+	}
+	return sk, nil
+}
+
+// CurrentKey ...
+func (sk *StaticKeys) CurrentKey() (string, []byte, error) {
+	return sk.current, sk.keys[sk.current], nil
+}
+
+// Key ...
+func (sk *StaticKeys) Key(id string) ([]byte, error) {
+	if key, ok := sk.keys[id]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
@@ -0,0 +1,148 @@
+// Package seal encrypts values of attributes at rest with envelope encryption,
+// and computes blind indexes for exact match of sealed values
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ErrMalformed the sealed value is not valid
+var ErrMalformed = errors.New("seal: malformed value")
+
+const (
+	version  = "v1"
+	dekSize  = 32
+	sepField = "."
+)
+
+var b64 = base64.RawURLEncoding
+
+// Sealer seals values with a random data key per value, the data key is wrapped by the current key of KeyProvider,
+// a sealed value is "v1.<key id>.<wrapped data key>.<ciphertext>"
+type Sealer struct {
+	keys     KeyProvider
+	indexKey []byte
+}
+
+// New returns a Sealer, indexKey is the HMAC key of blind indexes, which must not change
+func New(keys KeyProvider, indexKey []byte) *Sealer {
+	return &Sealer{keys: keys, indexKey: append([]byte(nil), indexKey...)}
+}
+
+// Seal encrypts plain, aad is authenticated but not encrypted, such as the attribute name
+func (s *Sealer) Seal(plain, aad []byte) (string, error) {
+	id, kek, err := s.keys.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	dek := make([]byte, dekSize)
+	if _, err = io.ReadFull(rand.Reader, dek); err != nil {
+		return "", err
+	}
+	wrapped, err := gcmSeal(kek, dek, []byte(id))
+	if err != nil {
+		return "", err
+	}
+	ct, err := gcmSeal(dek, plain, aad)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join([]string{version, id, b64.EncodeToString(wrapped), b64.EncodeToString(ct)}, sepField), nil
+}
+
+// Open decrypts a value of Seal with the same aad
+func (s *Sealer) Open(sealed string, aad []byte) ([]byte, error) {
+	id, wrapped, ct, err := parse(sealed)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := s.keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := gcmOpen(kek, wrapped, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	return gcmOpen(dek, ct, aad)
+}
+
+// KeyID returns the key id of a sealed value
+func KeyID(sealed string) (string, error) {
+	id, _, _, err := parse(sealed)
+	return id, err
+}
+
+// Stale reports whether sealed is not sealed by the current key, and should be sealed again
+func (s *Sealer) Stale(sealed string) bool {
+	id, err := KeyID(sealed)
+	if err != nil {
+		return true
+	}
+	cur, _, err := s.keys.CurrentKey()
+	return err == nil && id != cur
+}
+
+// Index returns the blind index of value of name, a hex HMAC-SHA256
+func (s *Sealer) Index(name, value string) string {
+	mac := hmac.New(sha256.New, s.indexKey)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func parse(sealed string) (id string, wrapped, ct []byte, err error) {
+	parts := strings.Split(sealed, sepField)
+	if len(parts) != 4 || parts[0] != version || parts[1] == "" {
+		return "", nil, nil, ErrMalformed
+	}
+	if wrapped, err = b64.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	if ct, err = b64.DecodeString(parts[3]); err != nil {
+		return "", nil, nil, ErrMalformed
+	}
+	return parts[1], wrapped, ct, nil
+}
+
+// gcmSeal returns nonce and ciphertext
+func gcmSeal(key, plain, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, aad), nil
+}
+
+func gcmOpen(key, data, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
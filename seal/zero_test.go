@@ -0,0 +1,59 @@
+package seal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeal(t *testing.T) {
+	k1, k2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 16)
+	keys, err := NewStaticKeys("k1", map[string][]byte{"k1": k1})
+	assert.NoError(t, err)
+	s := New(keys, []byte("index"))
+
+	sealed, err := s.Seal([]byte("110101199001011234"), []byte("idcnNumber"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "v1.k1."), sealed)
+	assert.NotContains(t, sealed, "1101011990")
+	sealed2, _ := s.Seal([]byte("110101199001011234"), []byte("idcnNumber"))
+	assert.NotEqual(t, sealed, sealed2, "random data key and nonce")
+
+	plain, err := s.Open(sealed, []byte("idcnNumber"))
+	assert.NoError(t, err)
+	assert.Equal(t, "110101199001011234", string(plain))
+	_, err = s.Open(sealed, []byte("mobile"))
+	assert.Error(t, err, "aad mismatch")
+	_, err = s.Open("v1.k1.abc", nil)
+	assert.ErrorIs(t, err, ErrMalformed)
+	assert.False(t, s.Stale(sealed))
+
+	// rotate
+	keys2, err := NewStaticKeys("k2", map[string][]byte{"k1": k1, "k2": k2})
+	assert.NoError(t, err)
+	s2 := New(keys2, []byte("index"))
+	assert.True(t, s2.Stale(sealed))
+	plain, err = s2.Open(sealed, []byte("idcnNumber"))
+	assert.NoError(t, err)
+	assert.Equal(t, "110101199001011234", string(plain))
+	sealed3, _ := s2.Seal(plain, []byte("idcnNumber"))
+	id, _ := KeyID(sealed3)
+	assert.Equal(t, "k2", id)
+	_, err = s.Open(sealed3, []byte("idcnNumber"))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	assert.Equal(t, s.Index("idcnNumber", "1"), s2.Index("idcnNumber", "1"))
+	assert.NotEqual(t, s.Index("idcnNumber", "1"), s.Index("mobile", "1"))
+	assert.Len(t, s.Index("idcnNumber", "1"), 64)
+}
+
+func TestStaticKeys(t *testing.T) {
+	_, err := NewStaticKeys("k0", map[string][]byte{"k1": make([]byte, 16)})
+	assert.ErrorIs(t, err, ErrNoKey)
+	_, err = NewStaticKeys("k1", map[string][]byte{"k1": make([]byte, 15)})
+	assert.Error(t, err)
+	_, err = NewStaticKeys("k.1", map[string][]byte{"k.1": make([]byte, 16)})
+	assert.Error(t, err)
+}